@@ -0,0 +1,92 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"errors"
+	"net"
+
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/tlsconfig"
+)
+
+// DefaultAddr is the default listen address of the admin server, only reachable locally
+const DefaultAddr = "127.0.0.1:8081"
+
+// ServerCfg holds the admin server configuration
+type ServerCfg struct {
+	// Addr is the host:port the admin server listens on
+	Addr string
+	// TLS is enabled when a certificate file is set. Setting a client CA file
+	// requires the clients to authenticate with a certificate.
+	TLS tlsconfig.ServerCfg
+	// Token is the bearer token the clients must send in their Authorization header, when set
+	Token string
+	// Pprof enables the /debug/pprof endpoints
+	Pprof bool
+	// PublicProbes serves /healthz and /readyz without authentication, for orchestrators probes
+	PublicProbes bool
+	// Insecure allows serving the admin endpoints without any authentication, for development
+	Insecure bool
+}
+
+// ViperCfgFields returns the list of configuration fields needed to load a ServerCfg
+func (c *ServerCfg) ViperCfgFields() []config.ViperCfgField {
+	return append([]config.ViperCfgField{
+		{Target: &c.Addr, KeyName: "admin-addr", CfgType: config.ViperString, DefaultValue: DefaultAddr},
+		{Target: &c.Token, KeyName: "admin-token", CfgType: config.ViperString, DefaultValue: "", EnvMapping: "ADMIN_TOKEN"},
+		{Target: &c.Pprof, KeyName: "admin-pprof", CfgType: config.ViperBool, DefaultValue: false},
+		{Target: &c.PublicProbes, KeyName: "admin-public-probes", CfgType: config.ViperBool, DefaultValue: false},
+		{Target: &c.Insecure, KeyName: "admin-insecure", CfgType: config.ViperBool, DefaultValue: false},
+	}, c.TLS.ViperCfgFields("admin")...)
+}
+
+// Validate checks the configuration is usable
+func (c ServerCfg) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return errors.New("admin address must be a host:port")
+	}
+
+	if c.tlsEnabled() {
+		if err := c.TLS.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Token == "" && !c.mutualTLS() && !c.Insecure {
+		return errors.New("admin server requires a token or a TLS client CA, unless insecure")
+	}
+
+	return nil
+}
+
+func (c ServerCfg) tlsEnabled() bool {
+	return c.TLS.CertFile != ""
+}
+
+// mutualTLS returns true when the clients are authenticated by their certificate
+func (c ServerCfg) mutualTLS() bool {
+	if !c.tlsEnabled() || c.TLS.ClientCAFile == "" {
+		return false
+	}
+
+	switch c.TLS.ClientAuth {
+	case "", tlsconfig.ClientAuthVerifyIfGiven, tlsconfig.ClientAuthRequireAndVerify:
+		return true
+	default:
+		// certificates which are not verified do not authenticate the clients
+		return false
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admin provides the HTTP admin server shared by every server application,
+// exposing its health, readiness, version and effective configuration.
+//
+//	var adminCfg admin.ServerCfg
+//	loader.Load(adminCfg.ViperCfgFields())
+//
+//	server, err := admin.NewServer(adminCfg,
+//		admin.WithCheckers(dbHealthChecker),
+//		admin.WithVersion(admin.VersionInfo{Version: version, Commit: commit}),
+//		admin.WithConfigFields(fields),
+//	)
+//	manager.Register(server.Component(manager))
+//
+// The endpoints are protected by a bearer token and/or client certificates, as configured.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/health"
+	"github.com/teserakt-io/serverlib/lifecycle"
+)
+
+// DefaultComponentName is the name of the admin server lifecycle.Component
+const DefaultComponentName = "admin"
+
+// List of the admin endpoints
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+	VersionPath = "/version"
+	ConfigPath  = "/config"
+	PprofPath   = "/debug/pprof/"
+)
+
+// readHeaderTimeout protects the admin server against slow clients
+const readHeaderTimeout = 10 * time.Second
+
+// VersionInfo is returned by the /version endpoint
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	// GoVersion is set from the runtime when empty
+	GoVersion string `json:"go_version"`
+}
+
+// CheckStatus is the status of a health.Checker returned by the /readyz endpoint
+type CheckStatus struct {
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutive_failures,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastCheck           time.Time `json:"last_check"`
+	LastSuccess         time.Time `json:"last_success"`
+}
+
+// Readiness is returned by the /readyz endpoint, with a 503 status code when not ready
+type Readiness struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+// Server is the HTTP admin server
+type Server interface {
+	// Handler returns the admin endpoints, with authentication
+	Handler() http.Handler
+	// Start listens on the configured address and serves in the background
+	Start(ctx context.Context) error
+	// Stop gracefully shuts the server down, until ctx is done
+	Stop(ctx context.Context) error
+	// Addr returns the address the server listens on once started, nil otherwise
+	Addr() net.Addr
+	// Component returns the lifecycle component of the server, reporting serving errors to manager
+	Component(manager lifecycle.Manager) lifecycle.Component
+}
+
+// ServerOption defines functions able to alter a Server
+type ServerOption func(*server)
+
+// WithCheckers adds health checkers aggregated by the /readyz endpoint
+func WithCheckers(checkers ...health.Checker) ServerOption {
+	return func(s *server) {
+		s.checkers = append(s.checkers, checkers...)
+	}
+}
+
+// WithVersion sets the VersionInfo returned by the /version endpoint
+func WithVersion(version VersionInfo) ServerOption {
+	return func(s *server) {
+		s.version = version
+	}
+}
+
+// WithConfigFields sets the loaded configuration fields returned, redacted, by the /config endpoint
+func WithConfigFields(fields []config.ViperCfgField) ServerOption {
+	return func(s *server) {
+		s.configFields = fields
+	}
+}
+
+// WithHandler serves an additional authenticated endpoint, such as metrics
+func WithHandler(pattern string, handler http.Handler) ServerOption {
+	return func(s *server) {
+		s.mux.Handle(pattern, handler)
+	}
+}
+
+// WithLogger overrides the default slog logger
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *server) {
+		s.logger = logger
+	}
+}
+
+type server struct {
+	cfg          ServerCfg
+	checkers     []health.Checker
+	version      VersionInfo
+	configFields []config.ViperCfgField
+	logger       *slog.Logger
+
+	mux     *http.ServeMux
+	handler http.Handler
+
+	lock       sync.Mutex
+	httpServer *http.Server
+	listener   net.Listener
+	onError    func(error)
+}
+
+var _ Server = (*server)(nil)
+
+// NewServer validates cfg and creates a new admin Server
+func NewServer(cfg ServerCfg, opts ...ServerOption) (Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &server{
+		cfg:    cfg,
+		logger: slog.Default(),
+		mux:    http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.version.GoVersion == "" {
+		s.version.GoVersion = runtime.Version()
+	}
+
+	s.mux.HandleFunc(VersionPath, getOnly(s.serveVersion))
+	s.mux.HandleFunc(ConfigPath, getOnly(s.serveConfig))
+	if cfg.Pprof {
+		s.mux.HandleFunc(PprofPath, pprof.Index)
+		s.mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+		s.mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+		s.mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+		s.mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+	}
+
+	root := http.NewServeMux()
+	probes := s.mux
+	if cfg.PublicProbes {
+		probes = root
+	}
+	probes.HandleFunc(HealthzPath, getOnly(s.serveHealthz))
+	probes.HandleFunc(ReadyzPath, getOnly(s.serveReadyz))
+
+	root.Handle("/", s.authenticate(s.mux))
+	s.handler = root
+
+	return s, nil
+}
+
+func (s *server) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *server) Start(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.httpServer != nil {
+		return errors.New("admin server already started")
+	}
+
+	listener, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	if s.cfg.tlsEnabled() {
+		tlsConfig, err := s.cfg.TLS.TLSConfig()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	httpServer := &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+	}
+	s.httpServer = httpServer
+	s.listener = listener
+	onError := s.onError
+
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("admin server failed", "error", err)
+			if onError != nil {
+				onError(err)
+			}
+		}
+	}()
+	s.logger.Info("admin server listening", "addr", listener.Addr().String(), "tls", s.cfg.tlsEnabled())
+
+	return nil
+}
+
+func (s *server) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.httpServer == nil {
+		return nil
+	}
+
+	err := s.httpServer.Shutdown(ctx)
+	s.httpServer = nil
+	s.listener = nil
+
+	return err
+}
+
+func (s *server) Addr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Addr()
+}
+
+func (s *server) Component(manager lifecycle.Manager) lifecycle.Component {
+	s.lock.Lock()
+	s.onError = func(err error) {
+		manager.Fail(DefaultComponentName, err)
+	}
+	s.lock.Unlock()
+
+	return lifecycle.Component{
+		Name:  DefaultComponentName,
+		Start: s.Start,
+		Stop:  s.Stop,
+	}
+}
+
+// authenticate requires the configured bearer token and client certificate. When both are configured,
+// both are required.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	handler := next
+	if s.cfg.Token != "" {
+		token := []byte(s.cfg.Token)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if !strings.HasPrefix(header, "Bearer ") ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), token) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	if s.cfg.mutualTLS() {
+		handler = s.cfg.TLS.ClientIdentity.IdentityMiddleware(handler)
+	}
+
+	return handler
+}
+
+func (s *server) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *server) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	readiness := Readiness{Ready: true, Checks: make(map[string]CheckStatus, len(s.checkers))}
+	for _, checker := range s.checkers {
+		status := checker.Status()
+
+		check := CheckStatus{
+			Healthy:             status.Healthy,
+			ConsecutiveFailures: status.ConsecutiveFailures,
+			LastCheck:           status.LastCheck,
+			LastSuccess:         status.LastSuccess,
+		}
+		if status.LastError != nil {
+			check.LastError = status.LastError.Error()
+		}
+
+		readiness.Checks[checker.Name()] = check
+		readiness.Ready = readiness.Ready && status.Healthy
+	}
+
+	code := http.StatusOK
+	if !readiness.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, readiness)
+}
+
+func (s *server) serveVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.version)
+}
+
+func (s *server) serveConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, config.EffectiveConfig(s.configFields))
+}
+
+// getOnly rejects the requests whose method is not GET nor HEAD
+func getOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/config/configtest"
+	"github.com/teserakt-io/serverlib/health"
+	"github.com/teserakt-io/serverlib/tlsconfig"
+)
+
+type testChecker struct {
+	name   string
+	status health.Status
+}
+
+func (c testChecker) Name() string          { return c.name }
+func (c testChecker) Status() health.Status { return c.status }
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestServerCfg(t *testing.T) {
+	t.Run("fields are loaded with defaults", func(t *testing.T) {
+		var cfg ServerCfg
+		fields := cfg.ViperCfgFields()
+		configtest.SetEnv(t, map[string]string{"ADMIN_TOKEN": "s3cr3t"})
+		configtest.MustLoad(t, configtest.NewLoader(t, "yaml", "admin-pprof: true\n"), fields)
+
+		configtest.AssertFields(t, fields, map[string]interface{}{
+			"admin-addr":     DefaultAddr,
+			"admin-token":    "s3cr3t",
+			"admin-pprof":    true,
+			"admin-tls-cert": "",
+		})
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("invalid configurations", func(t *testing.T) {
+		valid := ServerCfg{Addr: DefaultAddr, Token: "s3cr3t"}
+		for name, alter := range map[string]func(c *ServerCfg){
+			"address":           func(c *ServerCfg) { c.Addr = "8081" },
+			"no authentication": func(c *ServerCfg) { c.Token = "" },
+			"unverified client certificates": func(c *ServerCfg) {
+				c.Token = ""
+				c.TLS = tlsconfig.ServerCfg{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem", ClientAuth: tlsconfig.ClientAuthRequireAny}
+			},
+			"tls": func(c *ServerCfg) { c.TLS = tlsconfig.ServerCfg{CertFile: "cert.pem"} },
+		} {
+			cfg := valid
+			alter(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Errorf("Expected an error on invalid %s", name)
+			}
+		}
+
+		insecure := ServerCfg{Addr: DefaultAddr, Insecure: true}
+		if err := insecure.Validate(); err != nil {
+			t.Errorf("Expected no error on insecure configuration, got %v", err)
+		}
+	})
+}
+
+func TestServerHandler(t *testing.T) {
+	token := "s3cr3t"
+	password := "db-secret"
+	newServer := func(t *testing.T, cfg ServerCfg, opts ...ServerOption) http.Handler {
+		t.Helper()
+
+		cfg.Addr = DefaultAddr
+		cfg.Token = token
+		s, err := NewServer(cfg, append([]ServerOption{WithLogger(discardLogger)}, opts...)...)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		return s.Handler()
+	}
+
+	get := func(handler http.Handler, path string, authenticated bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authenticated {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("endpoints require the token", func(t *testing.T) {
+		handler := newServer(t, ServerCfg{})
+		for _, path := range []string{HealthzPath, ReadyzPath, VersionPath, ConfigPath} {
+			if rec := get(handler, path, false); rec.Code != http.StatusUnauthorized {
+				t.Errorf("Expected %s to be unauthorized, got %d", path, rec.Code)
+			}
+			if rec := get(handler, path, true); rec.Code != http.StatusOK {
+				t.Errorf("Expected %s to succeed, got %d", path, rec.Code)
+			}
+		}
+
+		req := httptest.NewRequest(http.MethodGet, VersionPath, nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a wrong token to be unauthorized, got %d", rec.Code)
+		}
+
+		req = httptest.NewRequest(http.MethodPost, VersionPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected POST to be rejected, got %d", rec.Code)
+		}
+	})
+
+	t.Run("public probes", func(t *testing.T) {
+		handler := newServer(t, ServerCfg{PublicProbes: true})
+		if rec := get(handler, HealthzPath, false); rec.Code != http.StatusOK {
+			t.Errorf("Expected public healthz, got %d", rec.Code)
+		}
+		if rec := get(handler, ConfigPath, false); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected config to be unauthorized, got %d", rec.Code)
+		}
+	})
+
+	t.Run("readyz aggregates the checkers", func(t *testing.T) {
+		database := &testChecker{name: "database", status: health.Status{Healthy: true}}
+		broker := &testChecker{name: "broker", status: health.Status{ConsecutiveFailures: 2, LastError: errors.New("connection refused")}}
+		handler := newServer(t, ServerCfg{}, WithCheckers(database, broker))
+
+		rec := get(handler, ReadyzPath, true)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected not ready, got %d", rec.Code)
+		}
+
+		var readiness Readiness
+		if err := json.Unmarshal(rec.Body.Bytes(), &readiness); err != nil {
+			t.Fatalf("Expected JSON readiness, got %v", err)
+		}
+		if readiness.Ready || !readiness.Checks["database"].Healthy || readiness.Checks["broker"].LastError != "connection refused" {
+			t.Errorf("Unexpected readiness %#v", readiness)
+		}
+
+		broker.status = health.Status{Healthy: true}
+		if rec := get(handler, ReadyzPath, true); rec.Code != http.StatusOK {
+			t.Errorf("Expected ready, got %d", rec.Code)
+		}
+	})
+
+	t.Run("version and redacted config", func(t *testing.T) {
+		var dbCfg config.DBCfg
+		dbCfg.Password = password
+		dbCfg.Username = "e4"
+
+		handler := newServer(t, ServerCfg{},
+			WithVersion(VersionInfo{Version: "1.2.3", Commit: "abcdef"}),
+			WithConfigFields(dbCfg.ViperCfgFields()),
+		)
+
+		var version VersionInfo
+		json.Unmarshal(get(handler, VersionPath, true).Body.Bytes(), &version)
+		if version.Version != "1.2.3" || version.Commit != "abcdef" || version.GoVersion == "" {
+			t.Errorf("Unexpected version %#v", version)
+		}
+
+		var effective map[string]interface{}
+		json.Unmarshal(get(handler, ConfigPath, true).Body.Bytes(), &effective)
+		if effective["db-password"] != config.RedactedValue || effective["db-username"] != "e4" {
+			t.Errorf("Unexpected configuration %v", effective)
+		}
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		if rec := get(newServer(t, ServerCfg{}), PprofPath, true); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected pprof to be disabled, got %d", rec.Code)
+		}
+		if rec := get(newServer(t, ServerCfg{Pprof: true}), PprofPath, true); rec.Code != http.StatusOK {
+			t.Errorf("Expected pprof to be enabled, got %d", rec.Code)
+		}
+	})
+
+	t.Run("additional handlers", func(t *testing.T) {
+		handler := newServer(t, ServerCfg{}, WithHandler("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("metrics"))
+		})))
+		if rec := get(handler, "/metrics", false); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected metrics to be unauthorized, got %d", rec.Code)
+		}
+		if rec := get(handler, "/metrics", true); rec.Body.String() != "metrics" {
+			t.Errorf("Unexpected metrics response %q", rec.Body.String())
+		}
+	})
+}
+
+func TestServerTLS(t *testing.T) {
+	resolver := configtest.NewTempResolver(t, nil)
+	report, err := tlsconfig.GenerateDevCerts(resolver)
+	if err != nil {
+		t.Fatalf("failed to generate certificates: %v", err)
+	}
+
+	s, err := NewServer(ServerCfg{
+		Addr:  "127.0.0.1:0",
+		Token: "s3cr3t",
+		TLS:   tlsconfig.ServerCfg{CertFile: report.ServerCert.Path, KeyFile: report.ServerKey.Path},
+	}, WithLogger(discardLogger))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	if err := s.Start(context.Background()); err == nil {
+		t.Error("Expected an error when starting twice")
+	}
+
+	caPEM, _ := os.ReadFile(report.CACert.Path)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://"+s.Addr().String()+HealthzPath, nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected healthz to succeed, got %d", resp.StatusCode)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if s.Addr() != nil {
+		t.Error("Expected no address once stopped")
+	}
+}
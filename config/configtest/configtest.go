@@ -0,0 +1,205 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configtest provides helpers to unit test code loading its configuration with the config package,
+// without writing files in the module tree or leaking environment variables between tests.
+//
+//	loader := configtest.NewLoader(t, "yaml", "listen: :8080")
+//	configtest.SetEnv(t, map[string]string{"APP_TOKEN": "secret"})
+//
+//	fields := cfg.ViperCfgFields()
+//	configtest.MustLoad(t, loader, fields)
+//	configtest.AssertFields(t, fields, map[string]interface{}{"listen": ":8080", "token": "secret"})
+package configtest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/path"
+)
+
+// ConfigName is the name of the configuration file written by NewLoader and NewLoaderFromMap
+const ConfigName = "config"
+
+// TempResolver is a path.ConfigDirResolver using a temporary directory, removed when the test ends
+type TempResolver struct {
+	t         testing.TB
+	configDir string
+}
+
+var _ path.ConfigDirResolver = (*TempResolver)(nil)
+
+// NewTempResolver returns a new TempResolver, creating the given files in its configuration directory.
+// The files keys are slash separated paths relative to the configuration directory, parent directories
+// being created as needed.
+func NewTempResolver(t testing.TB, files map[string]string) *TempResolver {
+	t.Helper()
+
+	r := &TempResolver{
+		t:         t,
+		configDir: t.TempDir(),
+	}
+	for name, content := range files {
+		r.WriteFile(name, content)
+	}
+
+	return r
+}
+
+// ConfigDir returns the temporary configuration directory
+func (r *TempResolver) ConfigDir() string {
+	return r.configDir
+}
+
+// ConfigRelativePath resolves a relative filepath from the configuration directory.
+// If the filepath is absolute then it is returned unchanged.
+func (r *TempResolver) ConfigRelativePath(relPath string) string {
+	if filepath.IsAbs(relPath) {
+		return relPath
+	}
+	return filepath.Join(r.configDir, relPath)
+}
+
+// WriteFile creates or replaces the file at the slash separated name in the configuration directory,
+// and returns its absolute path. The test fails when the file cannot be written.
+func (r *TempResolver) WriteFile(name, content string) string {
+	r.t.Helper()
+
+	filename := filepath.Join(r.configDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		r.t.Fatalf("failed to create directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		r.t.Fatalf("failed to write %s: %v", name, err)
+	}
+
+	return filename
+}
+
+// NewLoader returns a viper loader reading content as a configuration file of the given format,
+// such as "yaml" or "json". The file is written in the directory of a TempResolver, from which
+// the ViperRelativePath fields get resolved.
+func NewLoader(t testing.TB, format, content string, opts ...config.ViperLoaderOption) config.Loader {
+	t.Helper()
+
+	loader, _ := NewLoaderWithResolver(t, format, content, opts...)
+
+	return loader
+}
+
+// NewLoaderWithResolver is NewLoader, also returning the TempResolver so more files can be added
+// to the configuration directory.
+func NewLoaderWithResolver(t testing.TB, format, content string, opts ...config.ViperLoaderOption) (config.Loader, *TempResolver) {
+	t.Helper()
+
+	resolver := NewTempResolver(t, map[string]string{
+		ConfigName + "." + format: content,
+	})
+
+	return config.NewViperLoader(ConfigName, resolver, opts...), resolver
+}
+
+// NewLoaderFromMap returns a viper loader reading the given values, encoded as a JSON configuration file
+func NewLoaderFromMap(t testing.TB, values map[string]interface{}, opts ...config.ViperLoaderOption) config.Loader {
+	t.Helper()
+
+	content, err := json.Marshal(values)
+	if err != nil {
+		t.Fatalf("failed to encode configuration: %v", err)
+	}
+
+	return NewLoader(t, "json", string(content), opts...)
+}
+
+// SetEnv sets the given environment variables, restoring their previous values, or unsetting them,
+// when the test ends.
+func SetEnv(t testing.TB, vars map[string]string) {
+	t.Helper()
+
+	for name, value := range vars {
+		restoreEnv(t, name)
+		if err := os.Setenv(name, value); err != nil {
+			t.Fatalf("failed to set %s: %v", name, err)
+		}
+	}
+}
+
+// UnsetEnv unsets the given environment variables, restoring their previous values when the test ends.
+func UnsetEnv(t testing.TB, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		restoreEnv(t, name)
+		if err := os.Unsetenv(name); err != nil {
+			t.Fatalf("failed to unset %s: %v", name, err)
+		}
+	}
+}
+
+func restoreEnv(t testing.TB, name string) {
+	previous, ok := os.LookupEnv(name)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// MustLoad loads the fields, failing the test on error
+func MustLoad(t testing.TB, loader config.Loader, fields []config.ViperCfgField) {
+	t.Helper()
+
+	if err := loader.Load(fields); err != nil {
+		t.Fatalf("failed to load configuration: %v", err)
+	}
+}
+
+// AssertFields checks the loaded value of the fields identified by their KeyName.
+// Expected values are compared with the value pointed by the field Target, so they must have the
+// same type, such as config.DBType for a ViperDBType field. Every missing key is reported as an error.
+func AssertFields(t testing.TB, fields []config.ViperCfgField, expected map[string]interface{}) {
+	t.Helper()
+
+	targets := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		targets[field.KeyName] = field.Target
+	}
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		target, ok := targets[key]
+		if !ok {
+			t.Errorf("field %s not found", key)
+			continue
+		}
+
+		got := reflect.ValueOf(target).Elem().Interface()
+		if !reflect.DeepEqual(got, expected[key]) {
+			t.Errorf("field %s: expected %#v, got %#v", key, expected[key], got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+func TestNewLoader(t *testing.T) {
+	var name, file string
+	var count int
+	fields := []config.ViperCfgField{
+		{Target: &name, KeyName: "name", CfgType: config.ViperString},
+		{Target: &count, KeyName: "count", CfgType: config.ViperInt},
+		{Target: &file, KeyName: "file", CfgType: config.ViperRelativePath},
+	}
+
+	loader, resolver := NewLoaderWithResolver(t, "yaml", "name: test\ncount: 3\nfile: certs/cert.pem\n")
+	MustLoad(t, loader, fields)
+
+	AssertFields(t, fields, map[string]interface{}{
+		"name":  "test",
+		"count": 3,
+		"file":  filepath.Join(resolver.ConfigDir(), "certs", "cert.pem"),
+	})
+}
+
+func TestNewLoaderFromMap(t *testing.T) {
+	var dbType config.DBType
+	var hosts []string
+	fields := []config.ViperCfgField{
+		{Target: &dbType, KeyName: "db-type", CfgType: config.ViperDBType},
+		{Target: &hosts, KeyName: "hosts", CfgType: config.ViperStringSlice},
+	}
+
+	MustLoad(t, NewLoaderFromMap(t, map[string]interface{}{
+		"db-type": "postgres",
+		"hosts":   []string{"a", "b"},
+	}), fields)
+
+	AssertFields(t, fields, map[string]interface{}{
+		"db-type": config.DBTypePostgres,
+		"hosts":   []string{"a", "b"},
+	})
+}
+
+func TestEnv(t *testing.T) {
+	os.Setenv("CONFIGTEST_DEFINED", "previous")
+	os.Unsetenv("CONFIGTEST_UNDEFINED")
+	defer os.Unsetenv("CONFIGTEST_DEFINED")
+
+	t.Run("overrides", func(t *testing.T) {
+		SetEnv(t, map[string]string{
+			"CONFIGTEST_DEFINED":   "value",
+			"CONFIGTEST_UNDEFINED": "value",
+		})
+
+		var defined string
+		fields := []config.ViperCfgField{
+			{Target: &defined, KeyName: "defined", CfgType: config.ViperString, DefaultValue: "", EnvMapping: "CONFIGTEST_DEFINED"},
+		}
+		MustLoad(t, NewLoader(t, "json", "{}"), fields)
+		AssertFields(t, fields, map[string]interface{}{"defined": "value"})
+	})
+
+	if value := os.Getenv("CONFIGTEST_DEFINED"); value != "previous" {
+		t.Errorf("Expected CONFIGTEST_DEFINED to be restored to previous, got %s", value)
+	}
+	if _, ok := os.LookupEnv("CONFIGTEST_UNDEFINED"); ok {
+		t.Error("Expected CONFIGTEST_UNDEFINED to be unset")
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		UnsetEnv(t, "CONFIGTEST_DEFINED")
+		if _, ok := os.LookupEnv("CONFIGTEST_DEFINED"); ok {
+			t.Error("Expected CONFIGTEST_DEFINED to be unset")
+		}
+	})
+
+	if value := os.Getenv("CONFIGTEST_DEFINED"); value != "previous" {
+		t.Errorf("Expected CONFIGTEST_DEFINED to be restored to previous, got %s", value)
+	}
+}
@@ -14,6 +14,14 @@
 
 package config
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
 // DBType defines the different supported database types
 type DBType string
 
@@ -77,3 +85,245 @@ func (m DBSecureConnectionType) IsSelfSigned() bool {
 func (m DBSecureConnectionType) String() string {
 	return string(m)
 }
+
+// SQLite journal modes, see https://sqlite.org/pragma.html#pragma_journal_mode
+const (
+	SQLiteJournalModeDelete   = "DELETE"
+	SQLiteJournalModeTruncate = "TRUNCATE"
+	SQLiteJournalModePersist  = "PERSIST"
+	SQLiteJournalModeMemory   = "MEMORY"
+	SQLiteJournalModeWAL      = "WAL"
+	SQLiteJournalModeOff      = "OFF"
+)
+
+// SQLiteMemoryFile is the SQLite file name opening an in-memory database
+const SQLiteMemoryFile = ":memory:"
+
+// SQLite synchronous modes, see https://sqlite.org/pragma.html#pragma_synchronous
+const (
+	SQLiteSynchronousOff    = "OFF"
+	SQLiteSynchronousNormal = "NORMAL"
+	SQLiteSynchronousFull   = "FULL"
+	SQLiteSynchronousExtra  = "EXTRA"
+)
+
+// DBCfg holds the database configuration
+type DBCfg struct {
+	Type             DBType
+	File             string
+	Host             string
+	Port             int
+	Database         string
+	Username         string
+	Password         string
+	Schema           string
+	SecureConnection DBSecureConnectionType
+	SQLite           SQLiteCfg
+	// Replicas lists the postgres read replicas of the database
+	Replicas []DBReplicaCfg
+}
+
+// DBReplicaCfg holds the configuration of a read replica. Other settings are shared with the primary database.
+type DBReplicaCfg struct {
+	Host             string                 `mapstructure:"host"`
+	Port             int                    `mapstructure:"port"`
+	SecureConnection DBSecureConnectionType `mapstructure:"secure-connection"`
+}
+
+// SQLiteCfg holds the SQLite specific settings, applied on every new connection
+type SQLiteCfg struct {
+	// JournalMode is one of the SQLiteJournalMode constants
+	JournalMode string
+	// BusyTimeout is the number of milliseconds to wait on a locked database before failing
+	BusyTimeout int
+	// ForeignKeys enables foreign key constraints enforcement
+	ForeignKeys bool
+	// Synchronous is one of the SQLiteSynchronous constants
+	Synchronous string
+	// CacheSize is the number of cached pages, or the cache size in KiB when negative. 0 keeps SQLite default.
+	CacheSize int
+	// SharedMemory opens File as an in-memory database, shared between every connection of the pool.
+	// It is mostly useful for tests.
+	SharedMemory bool
+}
+
+// ViperCfgFields returns the list of configuration fields needed to load a DBCfg
+func (c *DBCfg) ViperCfgFields() []ViperCfgField {
+	return []ViperCfgField{
+		{&c.Type, "db-type", ViperDBType, DBTypeEmpty, ""},
+		{&c.File, "db-file", ViperRelativePath, "", ""},
+		{&c.Host, "db-host", ViperString, "", ""},
+		{&c.Port, "db-port", ViperInt, 5432, ""},
+		{&c.Database, "db-database", ViperString, "", ""},
+		{&c.Username, "db-username", ViperString, "", ""},
+		{&c.Password, "db-password", ViperString, "", ""},
+		{&c.Schema, "db-schema", ViperString, "", ""},
+		{&c.SecureConnection, "db-secure-connection", ViperDBSecureConnection, DBSecureConnectionEnabled, ""},
+		{&c.SQLite.JournalMode, "db-sqlite-journal-mode", ViperString, SQLiteJournalModeWAL, ""},
+		{&c.SQLite.BusyTimeout, "db-sqlite-busy-timeout", ViperInt, 5000, ""},
+		{&c.SQLite.ForeignKeys, "db-sqlite-foreign-keys", ViperBool, true, ""},
+		{&c.SQLite.Synchronous, "db-sqlite-synchronous", ViperString, SQLiteSynchronousNormal, ""},
+		{&c.SQLite.CacheSize, "db-sqlite-cache-size", ViperInt, 0, ""},
+		{&c.SQLite.SharedMemory, "db-sqlite-shared-memory", ViperBool, false, ""},
+		{&c.Replicas, "db-replicas", ViperDBReplicas, []DBReplicaCfg{}, ""},
+		// must come last, so a non empty url overrides the above fields
+		{c, "db-url", ViperDatabaseURL, "", "DATABASE_URL"},
+	}
+}
+
+// Validate checks the configuration is usable for its database type
+func (c DBCfg) Validate() error {
+	switch c.Type {
+	case DBTypePostgres:
+		if c.Host == "" {
+			return errors.New("database host is required for postgres")
+		}
+		if c.Database == "" {
+			return errors.New("database name is required for postgres")
+		}
+		if c.Port < 0 || c.Port > 65535 {
+			return fmt.Errorf("invalid database port %d", c.Port)
+		}
+		for i, replica := range c.Replicas {
+			if replica.Host == "" {
+				return fmt.Errorf("database host is required for replica %d", i)
+			}
+			if replica.Port < 0 || replica.Port > 65535 {
+				return fmt.Errorf("invalid database port %d for replica %d", replica.Port, i)
+			}
+		}
+	case DBTypeSQLite:
+		if c.File == "" {
+			return errors.New("database file is required for sqlite")
+		}
+		if len(c.Replicas) > 0 {
+			return errors.New("replicas are not supported on sqlite")
+		}
+		return c.SQLite.Validate()
+	default:
+		return fmt.Errorf("unsupported database type %q", c.Type)
+	}
+
+	return nil
+}
+
+// ConnectionString returns the driver specific connection string for the database
+func (c DBCfg) ConnectionString() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+
+	switch c.Type {
+	case DBTypePostgres:
+		params := []string{
+			"host=" + quotePostgresValue(c.Host),
+			"dbname=" + quotePostgresValue(c.Database),
+		}
+		if c.Port != 0 {
+			params = append(params, "port="+strconv.Itoa(c.Port))
+		}
+		if c.Username != "" {
+			params = append(params, "user="+quotePostgresValue(c.Username))
+		}
+		if c.Password != "" {
+			params = append(params, "password="+quotePostgresValue(c.Password))
+		}
+		if c.Schema != "" {
+			params = append(params, "search_path="+quotePostgresValue(c.Schema))
+		}
+		params = append(params, c.SecureConnection.PostgresSSLMode())
+
+		return strings.Join(params, " "), nil
+	default: // DBTypeSQLite, as enforced by Validate
+		return c.SQLite.dsn(c.File), nil
+	}
+}
+
+// InMemory returns whether the configuration opens an in-memory SQLite database, having no file on disk
+func (c DBCfg) InMemory() bool {
+	return c.Type == DBTypeSQLite && (c.File == SQLiteMemoryFile || c.SQLite.SharedMemory)
+}
+
+// Replica returns the configuration of the i-th replica, sharing every setting but the host,
+// port and secure connection with the primary database.
+func (c DBCfg) Replica(i int) DBCfg {
+	replica := c.Replicas[i]
+
+	cfg := c
+	cfg.Host = replica.Host
+	cfg.Port = replica.Port
+	cfg.SecureConnection = replica.SecureConnection
+	cfg.Replicas = nil
+
+	return cfg
+}
+
+// Validate checks the SQLite settings are accepted by SQLite
+func (c SQLiteCfg) Validate() error {
+	switch strings.ToUpper(c.JournalMode) {
+	case "", SQLiteJournalModeDelete, SQLiteJournalModeTruncate, SQLiteJournalModePersist,
+		SQLiteJournalModeMemory, SQLiteJournalModeWAL, SQLiteJournalModeOff:
+	default:
+		return fmt.Errorf("invalid sqlite journal mode %q", c.JournalMode)
+	}
+
+	switch strings.ToUpper(c.Synchronous) {
+	case "", SQLiteSynchronousOff, SQLiteSynchronousNormal, SQLiteSynchronousFull, SQLiteSynchronousExtra:
+	default:
+		return fmt.Errorf("invalid sqlite synchronous mode %q", c.Synchronous)
+	}
+
+	if c.BusyTimeout < 0 {
+		return fmt.Errorf("invalid sqlite busy timeout %d, must be positive", c.BusyTimeout)
+	}
+
+	return nil
+}
+
+// dsn returns the go-sqlite3 data source name for file, holding the pragmas to be applied on each connection
+func (c SQLiteCfg) dsn(file string) string {
+	dsn := "file:" + sqliteFileEscaper.Replace(file)
+	if params := c.query(); len(params) > 0 {
+		dsn += "?" + params.Encode()
+	}
+
+	return dsn
+}
+
+// query returns the go-sqlite3 query parameters corresponding to the settings
+func (c SQLiteCfg) query() url.Values {
+	params := url.Values{}
+	if c.JournalMode != "" {
+		params.Set("_journal_mode", strings.ToUpper(c.JournalMode))
+	}
+	if c.Synchronous != "" {
+		params.Set("_synchronous", strings.ToUpper(c.Synchronous))
+	}
+	if c.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.Itoa(c.BusyTimeout))
+	}
+	if c.ForeignKeys {
+		params.Set("_foreign_keys", "1")
+	}
+	if c.CacheSize != 0 {
+		params.Set("_cache_size", strconv.Itoa(c.CacheSize))
+	}
+	if c.SharedMemory {
+		params.Set("mode", "memory")
+		params.Set("cache", "shared")
+	}
+
+	return params
+}
+
+// sqliteFileEscaper escapes characters having a special meaning in SQLite URI filenames
+var sqliteFileEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
+// quotePostgresValue quotes a libpq connection string value when needed
+func quotePostgresValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -14,7 +14,11 @@
 
 package config
 
-import "testing"
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
 
 func TestDBSecureConnectionType(t *testing.T) {
 	t.Run("PostgresSSLMode returns expected values", func(t *testing.T) {
@@ -91,3 +95,144 @@ func TestDBSecureConnectionType(t *testing.T) {
 		}
 	})
 }
+
+func TestDBCfg(t *testing.T) {
+	t.Run("ViperCfgFields loads the expected values", func(t *testing.T) {
+		resolver := &testResolver{
+			configDir: filepath.Join(getRootDir(), "test", "data"),
+		}
+
+		var cfg DBCfg
+		if err := NewViperLoader("_db.config", resolver).Load(cfg.ViperCfgFields()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expectedCfg := DBCfg{
+			Type:             DBTypeSQLite,
+			File:             resolver.ConfigRelativePath("e4.sqlite"),
+			Port:             5432,
+			SecureConnection: DBSecureConnectionEnabled,
+			SQLite: SQLiteCfg{
+				JournalMode: "truncate",
+				BusyTimeout: 1000,
+				ForeignKeys: false,
+				Synchronous: SQLiteSynchronousNormal,
+			},
+		}
+		if !reflect.DeepEqual(cfg, expectedCfg) {
+			t.Errorf("Expected config to be %#v, got %#v", expectedCfg, cfg)
+		}
+	})
+
+	t.Run("ViperCfgFields loads the replicas", func(t *testing.T) {
+		resolver := &testResolver{
+			configDir: filepath.Join(getRootDir(), "test", "data"),
+		}
+
+		var cfg DBCfg
+		if err := NewViperLoader("_db_replicas.config", resolver).Load(cfg.ViperCfgFields()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expectedReplicas := []DBReplicaCfg{
+			{Host: "replica1.local", Port: 5433, SecureConnection: DBSecureConnectionSelfSigned},
+			{Host: "replica2.local", SecureConnection: DBSecureConnectionInsecure},
+		}
+		if !reflect.DeepEqual(cfg.Replicas, expectedReplicas) {
+			t.Errorf("Expected replicas to be %#v, got %#v", expectedReplicas, cfg.Replicas)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+
+		expectedReplicaCfg := cfg
+		expectedReplicaCfg.Host = "replica1.local"
+		expectedReplicaCfg.Port = 5433
+		expectedReplicaCfg.SecureConnection = DBSecureConnectionSelfSigned
+		expectedReplicaCfg.Replicas = nil
+		if replicaCfg := cfg.Replica(0); !reflect.DeepEqual(replicaCfg, expectedReplicaCfg) {
+			t.Errorf("Expected replica config to be %#v, got %#v", expectedReplicaCfg, replicaCfg)
+		}
+	})
+
+	t.Run("Validate returns expected errors", func(t *testing.T) {
+		testCases := []struct {
+			cfg         DBCfg
+			expectError bool
+		}{
+			{cfg: DBCfg{Type: DBTypeSQLite, File: "db.sqlite"}, expectError: false},
+			{cfg: DBCfg{Type: DBTypeSQLite}, expectError: true},
+			{cfg: DBCfg{Type: DBTypeSQLite, File: "db.sqlite", SQLite: SQLiteCfg{JournalMode: "wal"}}, expectError: false},
+			{cfg: DBCfg{Type: DBTypeSQLite, File: "db.sqlite", SQLite: SQLiteCfg{JournalMode: "invalid"}}, expectError: true},
+			{cfg: DBCfg{Type: DBTypeSQLite, File: "db.sqlite", SQLite: SQLiteCfg{Synchronous: "invalid"}}, expectError: true},
+			{cfg: DBCfg{Type: DBTypeSQLite, File: "db.sqlite", SQLite: SQLiteCfg{BusyTimeout: -1}}, expectError: true},
+			{cfg: DBCfg{Type: DBTypePostgres, Host: "localhost", Database: "e4"}, expectError: false},
+			{cfg: DBCfg{Type: DBTypePostgres, Database: "e4"}, expectError: true},
+			{cfg: DBCfg{Type: DBTypePostgres, Host: "localhost"}, expectError: true},
+			{cfg: DBCfg{Type: DBTypeEmpty}, expectError: true},
+			{cfg: DBCfg{Type: DBTypePostgres, Host: "localhost", Database: "e4", Replicas: []DBReplicaCfg{{}}}, expectError: true},
+			{cfg: DBCfg{Type: DBTypeSQLite, File: "db.sqlite", Replicas: []DBReplicaCfg{{Host: "replica"}}}, expectError: true},
+		}
+
+		for _, testCase := range testCases {
+			err := testCase.cfg.Validate()
+			if testCase.expectError && err == nil {
+				t.Errorf("Expected an error for config %#v, got nil", testCase.cfg)
+			}
+			if !testCase.expectError && err != nil {
+				t.Errorf("Expected no error for config %#v, got %v", testCase.cfg, err)
+			}
+		}
+	})
+
+	t.Run("ConnectionString returns expected values", func(t *testing.T) {
+		testCases := []struct {
+			cfg         DBCfg
+			expectedDSN string
+		}{
+			{
+				cfg:         DBCfg{Type: DBTypeSQLite, File: "/var/lib/e4/db.sqlite"},
+				expectedDSN: "file:/var/lib/e4/db.sqlite",
+			},
+			{
+				cfg: DBCfg{Type: DBTypeSQLite, File: "/tmp/what?.sqlite", SQLite: SQLiteCfg{
+					JournalMode: "wal",
+					BusyTimeout: 5000,
+					ForeignKeys: true,
+					Synchronous: SQLiteSynchronousNormal,
+					CacheSize:   -2000,
+				}},
+				expectedDSN: "file:/tmp/what%3f.sqlite?_busy_timeout=5000&_cache_size=-2000&_foreign_keys=1&_journal_mode=WAL&_synchronous=NORMAL",
+			},
+			{
+				cfg:         DBCfg{Type: DBTypeSQLite, File: "test", SQLite: SQLiteCfg{SharedMemory: true}},
+				expectedDSN: "file:test?cache=shared&mode=memory",
+			},
+			{
+				cfg: DBCfg{
+					Type:             DBTypePostgres,
+					Host:             "localhost",
+					Port:             5432,
+					Database:         "e4",
+					Username:         "user",
+					Password:         "it's secret",
+					Schema:           "e4_c2",
+					SecureConnection: DBSecureConnectionSelfSigned,
+				},
+				expectedDSN: `host=localhost dbname=e4 port=5432 user=user password='it\'s secret' search_path=e4_c2 sslmode=require`,
+			},
+		}
+
+		for _, testCase := range testCases {
+			dsn, err := testCase.cfg.ConnectionString()
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			if dsn != testCase.expectedDSN {
+				t.Errorf("Expected connection string to be %s, got %s", testCase.expectedDSN, dsn)
+			}
+		}
+	})
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ConfigFormat defines the encoding of a configuration file
+type ConfigFormat string
+
+// List of supported configuration formats
+const (
+	ConfigFormatYAML ConfigFormat = "yaml"
+	ConfigFormatJSON ConfigFormat = "json"
+	ConfigFormatTOML ConfigFormat = "toml"
+	ConfigFormatHCL  ConfigFormat = "hcl"
+	// ConfigFormatDotenv defines a file of KEY=VALUE lines. Each key sets both the lower cased
+	// configuration key and the fields having it as EnvMapping.
+	ConfigFormatDotenv ConfigFormat = "env"
+)
+
+// ErrUnsupportedFormat is returned when the format of a configuration file cannot be handled
+var ErrUnsupportedFormat = errors.New("unsupported configuration format")
+
+// AmbiguousConfigError is returned when several configuration files are found for the configuration name,
+// such as config.yaml and config.json
+type AmbiguousConfigError struct {
+	Files []string
+}
+
+func (e *AmbiguousConfigError) Error() string {
+	return fmt.Sprintf("multiple configuration files found: %s", strings.Join(e.Files, ", "))
+}
+
+// extensions returns the file extensions of the format
+func (f ConfigFormat) extensions() []string {
+	if f == ConfigFormatYAML {
+		return []string{"yaml", "yml"}
+	}
+
+	return []string{string(f)}
+}
+
+// Validate checks the format is supported
+func (f ConfigFormat) Validate() error {
+	if f == ConfigFormatDotenv {
+		return nil
+	}
+	for _, ext := range viper.SupportedExts {
+		if string(f) == ext {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnsupportedFormat, f)
+}
+
+// formatFromFilename returns the format matching the filename extension
+func formatFromFilename(filename string) (ConfigFormat, error) {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if ext == "yml" {
+		return ConfigFormatYAML, nil
+	}
+
+	format := ConfigFormat(ext)
+	if err := format.Validate(); err != nil {
+		return "", fmt.Errorf("%w, from file %s", err, filename)
+	}
+
+	return format, nil
+}
+
+// findConfigFiles returns every existing configName file in dir, with an extension of format,
+// or of any supported format when empty.
+func findConfigFiles(dir, configName string, format ConfigFormat) []string {
+	var exts []string
+	if format != "" {
+		exts = format.extensions()
+	} else {
+		exts = append(append(exts, viper.SupportedExts...), string(ConfigFormatDotenv))
+	}
+
+	var files []string
+	for _, ext := range exts {
+		filename := filepath.Join(dir, configName+"."+ext)
+		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
+			files = append(files, filename)
+		}
+	}
+
+	return files
+}
+
+// parseConfig decodes content into the configuration settings
+func parseConfig(content []byte, format ConfigFormat, fields []ViperCfgField) (map[string]interface{}, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+
+	if format == ConfigFormatDotenv {
+		return parseDotenv(content, fields)
+	}
+
+	v := viper.New()
+	v.SetConfigType(string(format))
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+
+	return v.AllSettings(), nil
+}
+
+// parseDotenv decodes KEY=VALUE lines. Blank lines, # comments and export prefixes are ignored.
+// Values can be single quoted, kept verbatim, or double quoted, where \n, \" and \\ are unescaped.
+func parseDotenv(content []byte, fields []ViperCfgField) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid dotenv line %d: expected KEY=VALUE", lineNumber)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value, err := dotenvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid dotenv line %d: %v", lineNumber, err)
+		}
+
+		settings[strings.ToLower(key)] = value
+		for _, field := range fields {
+			if field.EnvMapping == key {
+				settings[strings.ToLower(field.KeyName)] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func dotenvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch quote := raw[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(raw, quote)
+		if end == 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+		value := raw[1:end]
+		if quote == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+		return value, nil
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+		return raw, nil
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestConfigFormats(t *testing.T) {
+	configDir := t.TempDir()
+	writeConfigFiles(t, configDir, map[string]string{
+		"app.yaml":      "name: yaml\ncount: 1\n",
+		"app.json":      `{"name": "json", "count": 2}`,
+		"app.toml":      "name = \"toml\"\ncount = 3\n",
+		"app.hcl":       "name = \"hcl\"\ncount = 4\n",
+		"app.env":       "# comment\nexport APP_NAME=\"dot\\\"env\"\ncount=5 # inline comment\n",
+		"app.conf":      "name: conf\ncount: 6\n",
+		"single.yml":    "name: single\ncount: 7\n",
+		"broken.config": "name=broken\n",
+	})
+	resolver := &testResolver{configDir: configDir}
+
+	testData := []struct {
+		name          string
+		configName    string
+		opts          []ViperLoaderOption
+		expectedName  string
+		expectedCount int
+	}{
+		{name: "discovery", configName: "single", expectedName: "single", expectedCount: 7},
+		{name: "discovery by format", configName: "app", opts: []ViperLoaderOption{WithConfigFormat(ConfigFormatTOML)}, expectedName: "toml", expectedCount: 3},
+		{name: "yaml file", opts: []ViperLoaderOption{WithConfigFile("app.yaml")}, expectedName: "yaml", expectedCount: 1},
+		{name: "json file", opts: []ViperLoaderOption{WithConfigFile("app.json")}, expectedName: "json", expectedCount: 2},
+		{name: "hcl file", opts: []ViperLoaderOption{WithConfigFile("app.hcl")}, expectedName: "hcl", expectedCount: 4},
+		{name: "dotenv file", opts: []ViperLoaderOption{WithConfigFile(filepath.Join(configDir, "app.env"))}, expectedName: `dot"env`, expectedCount: 5},
+		{name: "explicit format", opts: []ViperLoaderOption{WithConfigFile("app.conf"), WithConfigFormat(ConfigFormatYAML)}, expectedName: "conf", expectedCount: 6},
+		{name: "reader", opts: []ViperLoaderOption{WithConfigReader(strings.NewReader(`{"name": "reader", "count": 8}`), ConfigFormatJSON)}, expectedName: "reader", expectedCount: 8},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			var name string
+			var count int
+			fields := []ViperCfgField{
+				{&name, "name", ViperString, "", "APP_NAME"},
+				{&count, "count", ViperInt, 0, ""},
+			}
+
+			if err := NewViperLoader(data.configName, resolver, data.opts...).Load(fields); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if name != data.expectedName {
+				t.Errorf("Expected name to be %q, got %q", data.expectedName, name)
+			}
+			if count != data.expectedCount {
+				t.Errorf("Expected count to be %d, got %d", data.expectedCount, count)
+			}
+		})
+	}
+
+	t.Run("multiple candidate files", func(t *testing.T) {
+		err := NewViperLoader("app", resolver).Load(nil)
+
+		var ambiguousErr *AmbiguousConfigError
+		if !errors.As(err, &ambiguousErr) {
+			t.Fatalf("Expected an AmbiguousConfigError, got %v", err)
+		}
+
+		expectedFiles := []string{
+			filepath.Join(configDir, "app.json"),
+			filepath.Join(configDir, "app.toml"),
+			filepath.Join(configDir, "app.yaml"),
+			filepath.Join(configDir, "app.hcl"),
+			filepath.Join(configDir, "app.env"),
+		}
+		if !reflect.DeepEqual(ambiguousErr.Files, expectedFiles) {
+			t.Errorf("Expected files %v, got %v", expectedFiles, ambiguousErr.Files)
+		}
+	})
+
+	t.Run("no file of the requested format", func(t *testing.T) {
+		err := NewViperLoader("single", resolver, WithConfigFormat(ConfigFormatJSON)).Load(nil)
+
+		var notFoundErr viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFoundErr) {
+			t.Errorf("Expected a ConfigFileNotFoundError, got %v", err)
+		}
+	})
+
+	t.Run("unsupported extension", func(t *testing.T) {
+		err := NewViperLoader("", resolver, WithConfigFile("broken.config")).Load(nil)
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+		}
+	})
+}
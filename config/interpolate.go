@@ -0,0 +1,125 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// UndefinedEnvError is returned by strict interpolation when configuration values reference undefined environment variables
+type UndefinedEnvError struct {
+	// Names lists every undefined variable, sorted
+	Names []string
+}
+
+func (e *UndefinedEnvError) Error() string {
+	return fmt.Sprintf("configuration references undefined environment variables: %s", strings.Join(e.Names, ", "))
+}
+
+// envInterpolator expands ${VAR} and ${VAR:-default} placeholders, $${ being an escaped ${
+type envInterpolator struct {
+	undefined map[string]struct{}
+}
+
+func newEnvInterpolator() *envInterpolator {
+	return &envInterpolator{undefined: make(map[string]struct{})}
+}
+
+// err returns an *UndefinedEnvError when undefined variables were referenced, nil otherwise
+func (e *envInterpolator) err() error {
+	if len(e.undefined) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(e.undefined))
+	for name := range e.undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &UndefinedEnvError{Names: names}
+}
+
+// value interpolates every string found in value, recursing into maps and slices
+func (e *envInterpolator) value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return e.string(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = e.value(item)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = e.value(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = e.value(item)
+		}
+	}
+
+	return value
+}
+
+func (e *envInterpolator) string(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+
+		if start > 0 && s[start-1] == '$' {
+			b.WriteString(s[:start-1])
+			b.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end += start
+
+		b.WriteString(s[:start])
+		b.WriteString(e.lookup(s[start+2 : end]))
+		s = s[end+1:]
+	}
+}
+
+// lookup returns the value of a NAME or NAME:-default reference
+func (e *envInterpolator) lookup(ref string) string {
+	name, defaultValue, hasDefault := ref, "", false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, defaultValue, hasDefault = ref[:i], ref[i+2:], true
+	}
+
+	value, ok := os.LookupEnv(name)
+	if hasDefault && value == "" {
+		return defaultValue
+	}
+	if !ok {
+		e.undefined[name] = struct{}{}
+	}
+
+	return value
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/teserakt-io/serverlib/path"
+)
+
+func TestEnvInterpolation(t *testing.T) {
+	resolver := &testResolver{
+		configDir: filepath.Join(getRootDir(), "test", "data"),
+	}
+
+	t.Setenv("TEST_INTERPOLATION_HOST", "example.com")
+	t.Setenv("TEST_INTERPOLATION_PORT", "8443")
+	t.Setenv("TEST_INTERPOLATION_OVERRIDE", "from-env")
+
+	type testConfig struct {
+		URL        string
+		Port       int
+		Escaped    string
+		Price      string
+		Defaulted  string
+		Hosts      []string
+		NestedKey  string
+		Overridden string
+	}
+
+	fieldsFor := func(cfg *testConfig) []ViperCfgField {
+		return []ViperCfgField{
+			{&cfg.URL, "url", ViperString, "", ""},
+			{&cfg.Port, "port", ViperInt, 0, ""},
+			{&cfg.Escaped, "escaped", ViperString, "", ""},
+			{&cfg.Price, "price", ViperString, "", ""},
+			{&cfg.Defaulted, "defaulted", ViperString, "", ""},
+			{&cfg.Hosts, "hosts", ViperStringSlice, []string{}, ""},
+			{&cfg.NestedKey, "nested.key", ViperString, "", ""},
+			{&cfg.Overridden, "overridden", ViperString, "", "TEST_INTERPOLATION_OVERRIDE"},
+		}
+	}
+
+	t.Run("Load interpolates environment variables in values", func(t *testing.T) {
+		var cfg testConfig
+		loader := NewViperLoader("_interpolation.config", resolver, WithEnvInterpolation(true))
+		if err := loader.Load(fieldsFor(&cfg)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expectedCfg := testConfig{
+			URL:        "https://example.com:8443/api",
+			Port:       8443,
+			Escaped:    "${TEST_INTERPOLATION_HOST}",
+			Price:      "$5",
+			Defaulted:  "fallback",
+			Hosts:      []string{"example.com", "static"},
+			NestedKey:  "example.com",
+			Overridden: "from-env",
+		}
+		if !reflect.DeepEqual(cfg, expectedCfg) {
+			t.Errorf("Expected config to be %#v, got %#v", expectedCfg, cfg)
+		}
+	})
+
+	t.Run("Load keeps placeholders without interpolation", func(t *testing.T) {
+		var cfg testConfig
+		if err := NewViperLoader("_interpolation.config", resolver).Load(fieldsFor(&cfg)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if cfg.URL != "https://${TEST_INTERPOLATION_HOST}:8443/api" {
+			t.Errorf("Expected url to not be interpolated, got %s", cfg.URL)
+		}
+	})
+
+	t.Run("Strict interpolation lists every undefined variables", func(t *testing.T) {
+		var cfg testConfig
+		loader := NewViperLoader("_interpolation_undefined.config", resolver, WithEnvInterpolation(true))
+
+		err := loader.Load(fieldsFor(&cfg))
+
+		var undefinedErr *UndefinedEnvError
+		if !errors.As(err, &undefinedErr) {
+			t.Fatalf("Expected an UndefinedEnvError, got %v", err)
+		}
+
+		expectedNames := []string{"TEST_INTERPOLATION_UNDEFINED_HOST", "TEST_INTERPOLATION_UNDEFINED_PORT"}
+		if !reflect.DeepEqual(undefinedErr.Names, expectedNames) {
+			t.Errorf("Expected undefined variables to be %v, got %v", expectedNames, undefinedErr.Names)
+		}
+	})
+
+	t.Run("Non strict interpolation expands undefined variables to empty strings", func(t *testing.T) {
+		var cfg testConfig
+		loader := NewViperLoader("_interpolation_undefined.config", resolver, WithEnvInterpolation(false))
+		if err := loader.Load(fieldsFor(&cfg)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if cfg.URL != "https://:8443/api" {
+			t.Errorf("Expected url to be https://:8443/api, got %s", cfg.URL)
+		}
+		if cfg.Defaulted != "fallback" {
+			t.Errorf("Expected defaulted to be fallback, got %s", cfg.Defaulted)
+		}
+	})
+	t.Run("Interpolated paths are not expanded again by an ExpandingResolver", func(t *testing.T) {
+		dir := t.TempDir()
+		content := "escaped: $${TEST_INTERPOLATION_HOST}/server.pem\ninterpolated: ${TEST_INTERPOLATION_HOST}/server.pem\n"
+		if err := os.WriteFile(filepath.Join(dir, "_paths.yaml"), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		resolver := path.NewExpandingResolver(&testResolver{configDir: dir}, true)
+
+		var escaped, interpolated string
+		fields := []ViperCfgField{
+			{&escaped, "escaped", ViperRelativePath, "", ""},
+			{&interpolated, "interpolated", ViperRelativePath, "", ""},
+		}
+		if err := NewViperLoader("_paths", resolver, WithEnvInterpolation(true)).Load(fields); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if expected := filepath.Join(dir, "${TEST_INTERPOLATION_HOST}", "server.pem"); escaped != expected {
+			t.Errorf("Expected escaped path to be %s, got %s", expected, escaped)
+		}
+		if expected := filepath.Join(dir, "example.com", "server.pem"); interpolated != expected {
+			t.Errorf("Expected interpolated path to be %s, got %s", expected, interpolated)
+		}
+	})
+}
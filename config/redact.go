@@ -0,0 +1,70 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// RedactedValue replaces the sensitive values of the effective configuration
+const RedactedValue = "xxxxx"
+
+// sensitiveKeyWords lists the words of the configuration keys holding secrets
+var sensitiveKeyWords = []string{"password", "passphrase", "secret", "token", "credential", "private-key", "api-key"}
+
+// IsSensitiveKey returns true when the configuration key holds a secret, such as db-password or admin-token
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sensitiveKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EffectiveConfig returns the values loaded in the Target of the given fields, by KeyName,
+// once Load succeeded. Non-empty values of sensitive keys are replaced by RedactedValue,
+// and database URLs are returned without their password, so the result can be logged or exposed.
+func EffectiveConfig(fields []ViperCfgField) map[string]interface{} {
+	effective := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if field.CfgType == ViperDatabaseURL {
+			if cfg, ok := field.Target.(*DBCfg); ok && cfg.Type != DBTypeEmpty {
+				effective[field.KeyName] = cfg.RedactedURL()
+			} else {
+				effective[field.KeyName] = ""
+			}
+			continue
+		}
+
+		value := reflect.ValueOf(field.Target)
+		if value.Kind() != reflect.Ptr || value.IsNil() {
+			continue
+		}
+		value = value.Elem()
+
+		empty := value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0)
+		if IsSensitiveKey(field.KeyName) && !empty {
+			effective[field.KeyName] = RedactedValue
+			continue
+		}
+		effective[field.KeyName] = value.Interface()
+	}
+
+	return effective
+}
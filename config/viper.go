@@ -15,7 +15,12 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 
 	"github.com/spf13/viper"
 
@@ -31,20 +36,91 @@ type Loader interface {
 type viperConfigLoader struct {
 	v              *viper.Viper
 	configResolver path.ConfigDirResolver
+	configName     string
+
+	configFile string
+	format     ConfigFormat
+	reader     io.Reader
+	// content holds the configuration read from reader, as it cannot be read twice
+	content []byte
+
+	interpolateEnv       bool
+	strictInterpolateEnv bool
+}
+
+// configFileResolver is implemented by the path resolvers locating the configuration file from its name
+type configFileResolver interface {
+	ConfigFile(confFilename string) string
+}
+
+// expandedPathResolver is implemented by the path resolvers able to resolve paths whose
+// environment variables were already expanded, such as path.ExpandingResolver
+type expandedPathResolver interface {
+	ResolveExpandedPath(relPath string) (string, error)
+}
+
+// ViperLoaderOption defines functions able to alter the viper loader
+type ViperLoaderOption func(*viperConfigLoader)
+
+// WithEnvInterpolation enables the expansion of ${VAR} and ${VAR:-default} placeholders found in
+// the configuration file string values, before they get converted to their ViperType.
+// A literal ${ can be written as $${. When strict is set, loading fails with an *UndefinedEnvError
+// listing every referenced variable which is not defined, otherwise they expand to an empty string.
+// Paths are not expanded a second time by a path.ExpandingResolver, which only expands their leading ~.
+func WithEnvInterpolation(strict bool) ViperLoaderOption {
+	return func(loader *viperConfigLoader) {
+		loader.interpolateEnv = true
+		loader.strictInterpolateEnv = strict
+	}
+}
+
+// WithConfigFile loads the given file instead of searching the configName files in the configuration directory.
+// Relative filenames are resolved with the ConfigFile method of the resolver when available, such as
+// path.AppPathResolver.ConfigFile, or from the configuration directory otherwise.
+// The format is detected from the file extension unless set with WithConfigFormat.
+func WithConfigFile(filename string) ViperLoaderOption {
+	return func(loader *viperConfigLoader) {
+		loader.configFile = filename
+	}
+}
+
+// WithConfigFormat sets the configuration format. Without WithConfigFile, only the configName files
+// with an extension of this format are searched, Load returning an error wrapping a
+// viper.ConfigFileNotFoundError when none exists.
+func WithConfigFormat(format ConfigFormat) ViperLoaderOption {
+	return func(loader *viperConfigLoader) {
+		loader.format = format
+	}
+}
+
+// WithConfigReader reads the configuration of the given format from r, such as os.Stdin,
+// instead of a file. The reader is consumed by the first Load.
+func WithConfigReader(r io.Reader, format ConfigFormat) ViperLoaderOption {
+	return func(loader *viperConfigLoader) {
+		loader.reader = r
+		loader.format = format
+	}
 }
 
 // NewViperLoader creates a new configuration loader using Viper
 // It will attempt to load file identified by configName (without extension)
-// in pathResolver.ConfigDir()
-func NewViperLoader(configName string, configResolver path.ConfigDirResolver) Loader {
+// in pathResolver.ConfigDir(), failing with an *AmbiguousConfigError when several files are found.
+// Options allow loading an explicit file or reader, and forcing the format.
+func NewViperLoader(configName string, configResolver path.ConfigDirResolver, opts ...ViperLoaderOption) Loader {
 	v := viper.New()
 	v.SetConfigName(configName)
 	v.AddConfigPath(configResolver.ConfigDir())
 
-	return &viperConfigLoader{
+	loader := &viperConfigLoader{
 		v:              v,
 		configResolver: configResolver,
+		configName:     configName,
+	}
+	for _, opt := range opts {
+		opt(loader)
 	}
+
+	return loader
 }
 
 // ViperType allow to instruct viper how to cast the loaded values
@@ -65,7 +141,37 @@ const (
 	ViperDBSecureConnection
 	// ViperRelativePath defines a relative string path representation, from the config file location.
 	// Those field types will get normalized by the loader to their absolute location.
+	// When the resolver implements path.ConfigPathResolver, rejected paths make the loading fail.
+	// Empty values are left empty, so optional files can be detected.
 	ViperRelativePath
+	// ViperDatabaseURL defines a database URL, parsed into a DBCfg. Relative SQLite files are normalized
+	// to their absolute location from the config file, in-memory databases are kept as is.
+	// An empty value leaves the target DBCfg untouched.
+	ViperDatabaseURL
+	// ViperDBReplicas defines a list of DBReplicaCfg, each entry holding host, port and secure-connection keys
+	ViperDBReplicas
+	// ViperPathGlob defines a glob pattern relative to the config file location, loaded as the sorted []string
+	// of the matching files. Directories are never matched, and every match is checked by the resolver
+	// when it implements path.ConfigPathResolver.
+	ViperPathGlob
+	// ViperRequiredPathGlob is a ViperPathGlob failing the loading when no file matches
+	ViperRequiredPathGlob
+	// ViperDirectory defines a directory path relative to the config file location, which must exist.
+	// Empty values are left empty.
+	ViperDirectory
+	// ViperWritableDirectory is a ViperDirectory which must also be writable
+	ViperWritableDirectory
+	// ViperFloat64 defines a viper type for a float64
+	ViperFloat64
+)
+
+var (
+	// ErrNoGlobMatch is returned when no file matches a ViperRequiredPathGlob pattern
+	ErrNoGlobMatch = errors.New("no file matches the pattern")
+	// ErrNotDirectory is returned when a ViperDirectory does not point to a directory
+	ErrNotDirectory = errors.New("not a directory")
+	// ErrDirectoryNotWritable is returned when a ViperWritableDirectory is not writable
+	ErrDirectoryNotWritable = errors.New("directory is not writable")
 )
 
 // ViperCfgField defines a struct to instruct viper what and how to load configuration data.
@@ -94,7 +200,7 @@ func (loader *viperConfigLoader) Load(fields []ViperCfgField) error {
 		}
 	}
 
-	if err := loader.v.ReadInConfig(); err != nil {
+	if err := loader.readConfig(fields); err != nil {
 		return err
 	}
 
@@ -113,6 +219,9 @@ func (loader *viperConfigLoader) Load(fields []ViperCfgField) error {
 			v := field.Target.(*bool)
 			value := loader.v.GetBool(field.KeyName)
 			*v = value
+		case ViperFloat64:
+			v := field.Target.(*float64)
+			*v = loader.v.GetFloat64(field.KeyName)
 		case ViperDBType:
 			v := field.Target.(*DBType)
 			*v = DBType(loader.v.GetString(field.KeyName))
@@ -121,8 +230,52 @@ func (loader *viperConfigLoader) Load(fields []ViperCfgField) error {
 			*v = DBSecureConnectionType(loader.v.GetString(field.KeyName))
 		case ViperRelativePath:
 			v := field.Target.(*string)
-			path := loader.v.GetString(field.KeyName)
-			*v = loader.configResolver.ConfigRelativePath(path)
+			relPath := loader.v.GetString(field.KeyName)
+			if relPath == "" {
+				*v = ""
+				continue
+			}
+			path, err := loader.resolvePath(relPath)
+			if err != nil {
+				return fmt.Errorf("invalid path for field %v: %w", field.KeyName, err)
+			}
+			*v = path
+		case ViperDatabaseURL:
+			v := field.Target.(*DBCfg)
+			rawURL := loader.v.GetString(field.KeyName)
+			if rawURL == "" {
+				continue
+			}
+			if err := v.ApplyURL(rawURL); err != nil {
+				return fmt.Errorf("invalid value for field %v: %v", field.KeyName, err)
+			}
+			if v.Type == DBTypeSQLite && !v.InMemory() {
+				file, err := loader.resolvePath(v.File)
+				if err != nil {
+					return fmt.Errorf("invalid path for field %v: %w", field.KeyName, err)
+				}
+				v.File = file
+			}
+		case ViperPathGlob, ViperRequiredPathGlob:
+			v := field.Target.(*[]string)
+			files, err := loader.globFiles(loader.v.GetString(field.KeyName), field.CfgType == ViperRequiredPathGlob)
+			if err != nil {
+				return fmt.Errorf("invalid path for field %v: %w", field.KeyName, err)
+			}
+			*v = files
+		case ViperDirectory, ViperWritableDirectory:
+			v := field.Target.(*string)
+			dir, err := loader.directory(loader.v.GetString(field.KeyName), field.CfgType == ViperWritableDirectory)
+			if err != nil {
+				return fmt.Errorf("invalid path for field %v: %w", field.KeyName, err)
+			}
+			*v = dir
+		case ViperDBReplicas:
+			v := field.Target.(*[]DBReplicaCfg)
+			*v = nil
+			if err := loader.v.UnmarshalKey(field.KeyName, v); err != nil {
+				return fmt.Errorf("invalid value for field %v: %v", field.KeyName, err)
+			}
 		default:
 			return fmt.Errorf("unsupported configuration type %v for field %v", field.CfgType, field.KeyName)
 		}
@@ -130,3 +283,174 @@ func (loader *viperConfigLoader) Load(fields []ViperCfgField) error {
 
 	return nil
 }
+
+// readConfig reads the configuration from the reader, the explicit file or the configName file found
+// in the configuration directory, and sets its values in viper.
+// The environment variables placeholders are expanded here, so the defaults and environment
+// overrides are left untouched.
+func (loader *viperConfigLoader) readConfig(fields []ViperCfgField) error {
+	content, format, err := loader.configContent()
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		if loader.format == "" {
+			// no configuration file of any format found, let viper report it
+			return loader.v.ReadInConfig()
+		}
+
+		// viper would search the files of every format, its error fields cannot be set from here
+		return fmt.Errorf("no %s configuration file %q found in %s: %w",
+			loader.format, loader.configName, loader.configResolver.ConfigDir(), viper.ConfigFileNotFoundError{})
+	}
+
+	settings, err := parseConfig(content, format, fields)
+	if err != nil {
+		return err
+	}
+
+	if loader.interpolateEnv {
+		interpolator := newEnvInterpolator()
+		interpolator.value(settings)
+		if err := interpolator.err(); err != nil && loader.strictInterpolateEnv {
+			return err
+		}
+	}
+
+	return loader.v.MergeConfigMap(settings)
+}
+
+// configContent returns the raw configuration and its format, or a nil content when no file has been found.
+func (loader *viperConfigLoader) configContent() ([]byte, ConfigFormat, error) {
+	if loader.reader != nil {
+		if loader.content == nil {
+			content, err := io.ReadAll(loader.reader)
+			if err != nil {
+				return nil, "", err
+			}
+			loader.content = content
+		}
+
+		return loader.content, loader.format, nil
+	}
+
+	filename := loader.configFile
+	if filename != "" {
+		if !filepath.IsAbs(filename) {
+			if fileResolver, ok := loader.configResolver.(configFileResolver); ok {
+				filename = fileResolver.ConfigFile(filename)
+			} else {
+				filename = loader.configResolver.ConfigRelativePath(filename)
+			}
+		}
+	} else {
+		files := findConfigFiles(loader.configResolver.ConfigDir(), loader.configName, loader.format)
+		if len(files) > 1 {
+			return nil, "", &AmbiguousConfigError{Files: files}
+		}
+		if len(files) == 0 {
+			return nil, "", nil
+		}
+		filename = files[0]
+	}
+
+	format := loader.format
+	if format == "" {
+		var err error
+		if format, err = formatFromFilename(filename); err != nil {
+			return nil, "", err
+		}
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	loader.v.SetConfigFile(filename)
+
+	return content, format, nil
+}
+
+// resolvePath resolves relPath from the configuration directory. With environment interpolation,
+// the variables were already expanded and must not be expanded again by the resolver.
+func (loader *viperConfigLoader) resolvePath(relPath string) (string, error) {
+	if resolver, ok := loader.configResolver.(expandedPathResolver); ok && loader.interpolateEnv {
+		return resolver.ResolveExpandedPath(relPath)
+	}
+
+	return path.ResolveConfigPath(loader.configResolver, relPath)
+}
+
+// globFiles returns the sorted files matching pattern, resolved from the configuration directory
+func (loader *viperConfigLoader) globFiles(pattern string, required bool) ([]string, error) {
+	files := []string{}
+	if pattern == "" && !required {
+		return files, nil
+	}
+
+	resolvedPattern, err := loader.resolvePath(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(resolvedPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range matches {
+		// matches are resolved too, so the resolver can reject the ones symlinked out of the allowed directories.
+		// They are file names, whose environment variables must not be expanded.
+		var file string
+		if resolver, ok := loader.configResolver.(expandedPathResolver); ok {
+			file, err = resolver.ResolveExpandedPath(match)
+		} else {
+			file, err = path.ResolveConfigPath(loader.configResolver, match)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) == 0 && required {
+		return nil, fmt.Errorf("%w: %s", ErrNoGlobMatch, resolvedPattern)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// directory returns the existing directory at dir, resolved from the configuration directory.
+// An empty dir is returned as is.
+func (loader *viperConfigLoader) directory(dir string, writable bool) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+
+	resolvedDir, err := loader.resolvePath(dir)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(resolvedDir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%w: %s", ErrNotDirectory, resolvedDir)
+	}
+	if writable && !path.IsWritable(resolvedDir) {
+		return "", fmt.Errorf("%w: %s", ErrDirectoryNotWritable, resolvedDir)
+	}
+
+	return resolvedDir, nil
+}
@@ -15,6 +15,8 @@
 package config
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -34,6 +36,9 @@ func (t *testResolver) ConfigDir() string {
 }
 
 func (t *testResolver) ConfigRelativePath(relPath string) string {
+	if filepath.IsAbs(relPath) {
+		return relPath
+	}
 	return filepath.Join(t.configDir, relPath)
 }
 
@@ -56,6 +61,7 @@ func TestViper(t *testing.T) {
 		TestInt                       int
 		TestStringSlice               []string
 		TestBool                      bool
+		TestFloat                     float64
 		TestDbTypePostgress           DBType
 		TestDbTypeSQLite              DBType
 		TestDBSecureCnxTypeEnabled    DBSecureConnectionType
@@ -71,6 +77,7 @@ func TestViper(t *testing.T) {
 		ViperCfgField{&cfg.TestInt, "test-int", ViperInt, 0, ""},
 		ViperCfgField{&cfg.TestStringSlice, "test-stringslice", ViperStringSlice, []string{}, ""},
 		ViperCfgField{&cfg.TestBool, "test-bool", ViperBool, false, ""},
+		ViperCfgField{&cfg.TestFloat, "test-float", ViperFloat64, 0.0, ""},
 		ViperCfgField{&cfg.TestDbTypePostgress, "test-dbtype-postgres", ViperDBType, DBTypeEmpty, ""},
 		ViperCfgField{&cfg.TestDbTypeSQLite, "test-dbtype-sqlite3", ViperDBType, DBTypeEmpty, ""},
 		ViperCfgField{
@@ -106,6 +113,7 @@ func TestViper(t *testing.T) {
 		TestInt:                       1,
 		TestStringSlice:               []string{"str1", "str2"},
 		TestBool:                      true,
+		TestFloat:                     0.25,
 		TestDbTypePostgress:           DBTypePostgres,
 		TestDbTypeSQLite:              DBTypeSQLite,
 		TestDBSecureCnxTypeEnabled:    DBSecureConnectionEnabled,
@@ -118,3 +126,185 @@ func TestViper(t *testing.T) {
 		t.Errorf("Expected config to be %#v, got %#v", expectedCfg, cfg)
 	}
 }
+
+func TestViperConfinedPaths(t *testing.T) {
+	configDir := filepath.Join(getRootDir(), "test", "data")
+	resolver := path.NewConfinedResolver(&testResolver{configDir: configDir})
+
+	t.Run("ViperRelativePath fields escaping the config dir fail the loading", func(t *testing.T) {
+		var testPath string
+		fields := []ViperCfgField{
+			{&testPath, "test-path", ViperRelativePath, "", ""},
+		}
+
+		err := NewViperLoader("_viper.config", resolver).Load(fields)
+
+		var escapeErr *path.PathEscapeError
+		if !errors.As(err, &escapeErr) {
+			t.Fatalf("Expected a PathEscapeError, got %v", err)
+		}
+		if escapeErr.Path != "../test/path" {
+			t.Errorf("Expected error path to be ../test/path, got %s", escapeErr.Path)
+		}
+	})
+
+	t.Run("ViperRelativePath fields inside the config dir are resolved", func(t *testing.T) {
+		var testPath string
+		fields := []ViperCfgField{
+			{&testPath, "test-string", ViperRelativePath, "", ""},
+		}
+
+		if err := NewViperLoader("_viper.config", resolver).Load(fields); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expectedPath := filepath.Join(configDir, "str")
+		if testPath != expectedPath {
+			t.Errorf("Expected path to be %s, got %s", expectedPath, testPath)
+		}
+	})
+
+	t.Run("empty ViperRelativePath fields stay empty", func(t *testing.T) {
+		testPath := "previous"
+		fields := []ViperCfgField{
+			{&testPath, "undefined-path", ViperRelativePath, "", ""},
+		}
+
+		if err := NewViperLoader("_viper.config", resolver).Load(fields); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if testPath != "" {
+			t.Errorf("Expected path to be empty, got %s", testPath)
+		}
+	})
+}
+
+func TestViperPathGlobAndDirectory(t *testing.T) {
+	configDir := t.TempDir()
+	for _, name := range []string{"b.pem", "a.pem", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(configDir, name), nil, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(configDir, "dir.pem"), 0700); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	config := []byte("certs: \"*.pem\"\nkeys: \"*.key\"\ndata: dir.pem\nfile: notes.txt\n")
+	if err := os.WriteFile(filepath.Join(configDir, "_paths.config.yaml"), config, 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	resolver := &testResolver{configDir: configDir}
+
+	t.Run("ViperPathGlob loads the sorted matching files", func(t *testing.T) {
+		var certs, keys []string
+		fields := []ViperCfgField{
+			{&certs, "certs", ViperPathGlob, "", ""},
+			{&keys, "keys", ViperPathGlob, "", ""},
+		}
+
+		if err := NewViperLoader("_paths.config", resolver).Load(fields); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expectedCerts := []string{filepath.Join(configDir, "a.pem"), filepath.Join(configDir, "b.pem")}
+		if !reflect.DeepEqual(certs, expectedCerts) {
+			t.Errorf("Expected certs to be %v, got %v", expectedCerts, certs)
+		}
+		if len(keys) != 0 {
+			t.Errorf("Expected no keys, got %v", keys)
+		}
+	})
+
+	t.Run("ViperRequiredPathGlob fails when nothing matches", func(t *testing.T) {
+		var keys []string
+		fields := []ViperCfgField{
+			{&keys, "keys", ViperRequiredPathGlob, "", ""},
+		}
+
+		err := NewViperLoader("_paths.config", resolver).Load(fields)
+		if !errors.Is(err, ErrNoGlobMatch) {
+			t.Errorf("Expected ErrNoGlobMatch, got %v", err)
+		}
+	})
+
+	t.Run("ViperDirectory loads existing directories", func(t *testing.T) {
+		var dir, writableDir string
+		fields := []ViperCfgField{
+			{&dir, "data", ViperDirectory, "", ""},
+			{&writableDir, "data", ViperWritableDirectory, "", ""},
+		}
+
+		if err := NewViperLoader("_paths.config", resolver).Load(fields); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expectedDir := filepath.Join(configDir, "dir.pem")
+		if dir != expectedDir || writableDir != expectedDir {
+			t.Errorf("Expected directories to be %s, got %s and %s", expectedDir, dir, writableDir)
+		}
+	})
+
+	t.Run("ViperDirectory fails on files and missing directories", func(t *testing.T) {
+		var dir string
+
+		err := NewViperLoader("_paths.config", resolver).Load([]ViperCfgField{{&dir, "file", ViperDirectory, "", ""}})
+		if !errors.Is(err, ErrNotDirectory) {
+			t.Errorf("Expected ErrNotDirectory, got %v", err)
+		}
+
+		err = NewViperLoader("_paths.config", resolver).Load([]ViperCfgField{{&dir, "missing", ViperDirectory, "missing", ""}})
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected a not exist error, got %v", err)
+		}
+	})
+
+	t.Run("empty ViperDirectory fields stay empty", func(t *testing.T) {
+		dir, writableDir := "previous", "previous"
+		fields := []ViperCfgField{
+			{&dir, "undefined-dir", ViperDirectory, "", ""},
+			{&writableDir, "undefined-dir", ViperWritableDirectory, "", ""},
+		}
+
+		if err := NewViperLoader("_paths.config", resolver).Load(fields); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if dir != "" || writableDir != "" {
+			t.Errorf("Expected directories to be empty, got %s and %s", dir, writableDir)
+		}
+	})
+
+	t.Run("ViperPathGlob rejects matches escaping a confined resolver", func(t *testing.T) {
+		outsideDir := t.TempDir()
+		outsideFile := filepath.Join(outsideDir, "outside.pem")
+		if err := os.WriteFile(outsideFile, nil, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", outsideFile, err)
+		}
+		linkedDir := filepath.Join(configDir, "linked")
+		if err := os.Mkdir(linkedDir, 0700); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.Symlink(outsideFile, filepath.Join(linkedDir, "outside.pem")); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+
+		config := []byte("linked: \"linked/*.pem\"\n")
+		if err := os.WriteFile(filepath.Join(configDir, "_linked.config.yaml"), config, 0600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		var linked []string
+		fields := []ViperCfgField{
+			{&linked, "linked", ViperPathGlob, "", ""},
+		}
+
+		err := NewViperLoader("_linked.config", path.NewConfinedResolver(resolver)).Load(fields)
+		var escapeErr *path.PathEscapeError
+		if !errors.As(err, &escapeErr) {
+			t.Errorf("Expected a PathEscapeError, got %v", err)
+		}
+	})
+}
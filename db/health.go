@@ -0,0 +1,162 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/teserakt-io/serverlib/health"
+)
+
+const (
+	// DefaultHealthCheckName is the name reported by the database HealthChecker
+	DefaultHealthCheckName = "database"
+	// DefaultHealthCheckInterval is the default delay between two database pings
+	DefaultHealthCheckInterval = 10 * time.Second
+	// DefaultHealthCheckTimeout is the default maximum duration of a database ping
+	DefaultHealthCheckTimeout = 2 * time.Second
+	// DefaultHealthCheckFailureThreshold is the default number of consecutive failures
+	// before the database is reported unhealthy
+	DefaultHealthCheckFailureThreshold = 1
+)
+
+// HealthChecker defines a service periodically checking the database is reachable
+type HealthChecker interface {
+	health.Checker
+	// Check pings the database once and updates the status accordingly
+	Check(ctx context.Context) error
+	// Run checks the database every interval until ctx is done
+	Run(ctx context.Context)
+}
+
+// HealthCheckerOption defines functions able to alter a HealthChecker
+type HealthCheckerOption func(*healthChecker)
+
+// WithHealthCheckName overrides the DefaultHealthCheckName
+func WithHealthCheckName(name string) HealthCheckerOption {
+	return func(h *healthChecker) {
+		h.name = name
+	}
+}
+
+// WithHealthCheckInterval overrides the DefaultHealthCheckInterval.
+// Non positive intervals are ignored.
+func WithHealthCheckInterval(interval time.Duration) HealthCheckerOption {
+	return func(h *healthChecker) {
+		if interval > 0 {
+			h.interval = interval
+		}
+	}
+}
+
+// WithHealthCheckTimeout overrides the DefaultHealthCheckTimeout
+func WithHealthCheckTimeout(timeout time.Duration) HealthCheckerOption {
+	return func(h *healthChecker) {
+		h.timeout = timeout
+	}
+}
+
+// WithHealthCheckFailureThreshold overrides the DefaultHealthCheckFailureThreshold
+func WithHealthCheckFailureThreshold(threshold int) HealthCheckerOption {
+	return func(h *healthChecker) {
+		h.failureThreshold = threshold
+	}
+}
+
+type healthChecker struct {
+	db               *sql.DB
+	name             string
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+
+	lock   sync.RWMutex
+	status health.Status
+}
+
+var _ HealthChecker = (*healthChecker)(nil)
+
+// NewHealthChecker creates a new HealthChecker pinging db.
+// The database is reported unhealthy until the first successful check.
+func NewHealthChecker(db *sql.DB, opts ...HealthCheckerOption) HealthChecker {
+	h := &healthChecker{
+		db:               db,
+		name:             DefaultHealthCheckName,
+		interval:         DefaultHealthCheckInterval,
+		timeout:          DefaultHealthCheckTimeout,
+		failureThreshold: DefaultHealthCheckFailureThreshold,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func (h *healthChecker) Name() string {
+	return h.name
+}
+
+func (h *healthChecker) Status() health.Status {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.status
+}
+
+func (h *healthChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	err := h.db.PingContext(ctx)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.status.LastCheck = time.Now()
+	if err != nil {
+		h.status.ConsecutiveFailures++
+		h.status.LastError = err
+		if h.status.ConsecutiveFailures >= h.failureThreshold {
+			h.status.Healthy = false
+		}
+
+		return err
+	}
+
+	h.status.Healthy = true
+	h.status.ConsecutiveFailures = 0
+	h.status.LastSuccess = h.status.LastCheck
+
+	return nil
+}
+
+func (h *healthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+func TestHealthChecker(t *testing.T) {
+	ctx := context.Background()
+
+	openMemoryDB := func(t *testing.T) *healthChecker {
+		db, err := Open(config.DBCfg{
+			Type:   config.DBTypeSQLite,
+			File:   t.Name(),
+			SQLite: config.SQLiteCfg{SharedMemory: true},
+		})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return NewHealthChecker(db, WithHealthCheckFailureThreshold(2)).(*healthChecker)
+	}
+
+	t.Run("Status is unhealthy before the first check", func(t *testing.T) {
+		checker := openMemoryDB(t)
+
+		if checker.Name() != DefaultHealthCheckName {
+			t.Errorf("Expected name to be %s, got %s", DefaultHealthCheckName, checker.Name())
+		}
+
+		status := checker.Status()
+		if status.Healthy || !status.LastCheck.IsZero() {
+			t.Errorf("Expected an unhealthy and unchecked status, got %#v", status)
+		}
+	})
+
+	t.Run("Non positive intervals are ignored", func(t *testing.T) {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			checker := NewHealthChecker(nil, WithHealthCheckInterval(interval)).(*healthChecker)
+			if checker.interval != DefaultHealthCheckInterval {
+				t.Errorf("Expected interval %v to be ignored, got %v", interval, checker.interval)
+			}
+		}
+	})
+
+	t.Run("Check tracks consecutive failures", func(t *testing.T) {
+		checker := openMemoryDB(t)
+
+		if err := checker.Check(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		status := checker.Status()
+		if !status.Healthy || status.LastSuccess.IsZero() {
+			t.Errorf("Expected a healthy status, got %#v", status)
+		}
+
+		checker.db.Close()
+
+		if err := checker.Check(ctx); err == nil {
+			t.Fatalf("Expected an error, got nil")
+		}
+		status = checker.Status()
+		if !status.Healthy {
+			t.Errorf("Expected status to stay healthy below the failure threshold")
+		}
+		if status.ConsecutiveFailures != 1 || status.LastError == nil {
+			t.Errorf("Expected 1 consecutive failure with an error, got %#v", status)
+		}
+
+		checker.Check(ctx)
+		status = checker.Status()
+		if status.Healthy {
+			t.Errorf("Expected status to be unhealthy once the failure threshold is reached")
+		}
+		if status.ConsecutiveFailures != 2 {
+			t.Errorf("Expected 2 consecutive failures, got %d", status.ConsecutiveFailures)
+		}
+	})
+
+	t.Run("Run checks periodically until the context is done", func(t *testing.T) {
+		checker := openMemoryDB(t)
+		checker.interval = time.Millisecond
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			checker.Run(ctx)
+			close(done)
+		}()
+
+		deadline := time.After(time.Second)
+		for !checker.Status().Healthy {
+			select {
+			case <-deadline:
+				t.Fatalf("Timeout waiting for a healthy status")
+			case <-time.After(time.Millisecond):
+			}
+		}
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for Run to return")
+		}
+	})
+}
@@ -0,0 +1,437 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package db provides database helpers shared by the server applications,
+// working identically on every supported config.DBType.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/path"
+)
+
+// DefaultMigrationTable is the name of the table tracking applied migrations
+const DefaultMigrationTable = "schema_migrations"
+
+// migrationLockID is the postgres advisory lock key held while migrating.
+// It is an arbitrary constant shared by every serverlib migrator.
+const migrationLockID int64 = 0x7e5e4a6b
+
+var (
+	// ErrUnsupportedDBType is returned when the given DBType has no migration support
+	ErrUnsupportedDBType = errors.New("unsupported database type")
+	// ErrUnknownVersion is returned when a target version does not match any known migration
+	ErrUnknownVersion = errors.New("unknown migration version")
+	// ErrMissingDownMigration is returned when a rollback requires a migration without down script
+	ErrMissingDownMigration = errors.New("missing down migration")
+)
+
+// migrationFileRegexp matches migration files such as 0001_create_users.up.sql
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration defines a versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// MigrationDirection tells whether a migration step is applied or reverted
+type MigrationDirection string
+
+const (
+	// MigrationUp applies a migration
+	MigrationUp MigrationDirection = "up"
+	// MigrationDown reverts a migration
+	MigrationDown MigrationDirection = "down"
+)
+
+// MigrationStep describes a migration executed (or planned, in dry-run mode) by the Migrator
+type MigrationStep struct {
+	Migration Migration
+	Direction MigrationDirection
+}
+
+// MigrationsFromFS reads migrations from the root of fsys.
+// Files must be named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// the down file being optional. Other files are ignored.
+// Embedded migrations can be loaded using fs.Sub on an embed.FS.
+func MigrationsFromFS(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("conflicting names %q and %q for migration version %d", m.Name, matches[2], version)
+		}
+
+		switch MigrationDirection(matches[3]) {
+		case MigrationUp:
+			m.Up = string(content)
+		case MigrationDown:
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("missing up migration for version %d", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrationsFromDir reads migrations from dir, relative paths being resolved from the configuration directory.
+func MigrationsFromDir(resolver path.ConfigDirResolver, dir string) ([]Migration, error) {
+	return MigrationsFromFS(os.DirFS(resolver.ConfigRelativePath(dir)))
+}
+
+// Migrator defines a service able to apply and revert schema migrations
+type Migrator interface {
+	// Up applies every pending migration
+	Up(ctx context.Context) ([]MigrationStep, error)
+	// MigrateTo applies or reverts migrations until version is the last applied one.
+	// A version of 0 reverts every migrations.
+	MigrateTo(ctx context.Context, version int64) ([]MigrationStep, error)
+	// Status returns the state of every known migration, without creating the migration table
+	Status(ctx context.Context) ([]MigrationStatus, error)
+}
+
+// MigratorOption defines functions able to alter a Migrator
+type MigratorOption func(*migrator)
+
+// WithMigrationTable overrides the DefaultMigrationTable
+func WithMigrationTable(name string) MigratorOption {
+	return func(m *migrator) {
+		m.table = name
+	}
+}
+
+// WithDryRun makes the migrator only report the steps it would execute, without applying any migration
+func WithDryRun() MigratorOption {
+	return func(m *migrator) {
+		m.dryRun = true
+	}
+}
+
+type migrator struct {
+	db         *sql.DB
+	dbType     config.DBType
+	migrations []Migration
+	table      string
+	dryRun     bool
+}
+
+var _ Migrator = (*migrator)(nil)
+
+// NewMigrator creates a new Migrator applying given migrations on db.
+func NewMigrator(db *sql.DB, dbType config.DBType, migrations []Migration, opts ...MigratorOption) (Migrator, error) {
+	switch dbType {
+	case config.DBTypePostgres, config.DBTypeSQLite:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedDBType, dbType)
+	}
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", sorted[i].Version)
+		}
+	}
+
+	m := &migrator{
+		db:         db,
+		dbType:     dbType,
+		migrations: sorted,
+		table:      DefaultMigrationTable,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m, nil
+}
+
+func (m *migrator) Up(ctx context.Context) ([]MigrationStep, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+
+	return m.MigrateTo(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+func (m *migrator) MigrateTo(ctx context.Context, version int64) ([]MigrationStep, error) {
+	if version != 0 && m.indexOf(version) < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	var steps []MigrationStep
+	err := m.withConn(ctx, !m.dryRun, func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		steps, err = m.plan(applied, version)
+		if err != nil {
+			return err
+		}
+
+		if m.dryRun {
+			return nil
+		}
+
+		for i, step := range steps {
+			if err := m.execute(ctx, conn, step); err != nil {
+				steps = steps[:i]
+				return fmt.Errorf("migration %d_%s %s failed: %v", step.Migration.Version, step.Migration.Name, step.Direction, err)
+			}
+		}
+
+		return nil
+	})
+
+	return steps, err
+}
+
+func (m *migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withConn(ctx, false, func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			appliedAt, ok := applied[migration.Version]
+			statuses = append(statuses, MigrationStatus{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// plan computes the ordered steps required to reach target version
+func (m *migrator) plan(applied map[int64]time.Time, target int64) ([]MigrationStep, error) {
+	var steps []MigrationStep
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok && migration.Version <= target {
+			steps = append(steps, MigrationStep{Migration: migration, Direction: MigrationUp})
+		}
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; ok && migration.Version > target {
+			if migration.Down == "" {
+				return nil, fmt.Errorf("%w: version %d", ErrMissingDownMigration, migration.Version)
+			}
+			steps = append(steps, MigrationStep{Migration: migration, Direction: MigrationDown})
+		}
+	}
+
+	return steps, nil
+}
+
+// execute runs a single migration step and records it in the migration table, in a single transaction.
+func (m *migrator) execute(ctx context.Context, conn *sql.Conn, step MigrationStep) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch step.Direction {
+	case MigrationUp:
+		if _, err := tx.ExecContext(ctx, step.Migration.Up); err != nil {
+			return err
+		}
+		query := fmt.Sprintf(
+			"INSERT INTO %s (version, name, applied_at) VALUES (%s, %s, %s)",
+			m.table, m.placeholder(1), m.placeholder(2), m.placeholder(3),
+		)
+		if _, err := tx.ExecContext(ctx, query, step.Migration.Version, step.Migration.Name, time.Now().UTC()); err != nil {
+			return err
+		}
+	case MigrationDown:
+		if _, err := tx.ExecContext(ctx, step.Migration.Down); err != nil {
+			return err
+		}
+		query := fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.table, m.placeholder(1))
+		if _, err := tx.ExecContext(ctx, query, step.Migration.Version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// withConn runs fn on a dedicated connection, after having ensured the migration table
+// exists when createTable is set. On postgres, an advisory lock is held during fn execution
+// so concurrent migrators wait for each other.
+func (m *migrator) withConn(ctx context.Context, createTable bool, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dbType == config.DBTypePostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %v", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}
+
+	if createTable {
+		query := fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)",
+			m.table,
+		)
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create migration table: %v", err)
+		}
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions returns the applied_at time of every applied migration version.
+// A missing migration table means no migration has been applied yet.
+func (m *migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	applied := make(map[int64]time.Time)
+	exists, err := m.tableExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, applied_at FROM %s", m.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *migrator) tableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var exists bool
+	var err error
+	switch m.dbType {
+	case config.DBTypePostgres:
+		err = conn.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.table).Scan(&exists)
+	default:
+		err = conn.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?", m.table).Scan(&exists)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check migration table: %v", err)
+	}
+
+	return exists, nil
+}
+
+func (m *migrator) indexOf(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *migrator) placeholder(n int) string {
+	if m.dbType == config.DBTypePostgres {
+		return "$" + strconv.Itoa(n)
+	}
+
+	return "?"
+}
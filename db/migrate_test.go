@@ -0,0 +1,273 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+var testMigrationsFS = fstest.MapFS{
+	"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);")},
+	"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+	"0002_add_email.down.sql":    {Data: []byte("CREATE TABLE users_tmp (id INTEGER PRIMARY KEY, name TEXT); DROP TABLE users; ALTER TABLE users_tmp RENAME TO users;")},
+	"0003_create_groups.up.sql":  {Data: []byte("CREATE TABLE groups (id INTEGER PRIMARY KEY);")},
+	"README.md":                  {Data: []byte("not a migration")},
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open(config.DBTypeSQLite.String(), ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	// in memory databases are bound to their connection
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	row := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", name)
+	if err := row.Scan(&count); err != nil {
+		t.Fatalf("Failed to query tables: %v", err)
+	}
+
+	return count == 1
+}
+
+func TestMigrationsFromFS(t *testing.T) {
+	t.Run("MigrationsFromFS returns sorted migrations", func(t *testing.T) {
+		migrations, err := MigrationsFromFS(testMigrationsFS)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if len(migrations) != 3 {
+			t.Fatalf("Expected 3 migrations, got %d", len(migrations))
+		}
+
+		for i, expectedName := range []string{"create_users", "add_email", "create_groups"} {
+			if migrations[i].Version != int64(i+1) {
+				t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, migrations[i].Version)
+			}
+			if migrations[i].Name != expectedName {
+				t.Errorf("Expected migration %d to be named %s, got %s", i, expectedName, migrations[i].Name)
+			}
+		}
+
+		if migrations[2].Down != "" {
+			t.Errorf("Expected no down migration for version 3, got %s", migrations[2].Down)
+		}
+	})
+
+	t.Run("MigrationsFromFS returns an error on missing up migration", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		}
+
+		if _, err := MigrationsFromFS(fsys); err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	migrations, err := MigrationsFromFS(testMigrationsFS)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("NewMigrator rejects unsupported database types", func(t *testing.T) {
+		_, err := NewMigrator(openTestDB(t), config.DBTypeEmpty, migrations)
+		if !errors.Is(err, ErrUnsupportedDBType) {
+			t.Errorf("Expected error to be %v, got %v", ErrUnsupportedDBType, err)
+		}
+	})
+
+	t.Run("Up applies every migrations", func(t *testing.T) {
+		db := openTestDB(t)
+		migrator, err := NewMigrator(db, config.DBTypeSQLite, migrations)
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+
+		steps, err := migrator.Up(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(steps) != 3 {
+			t.Errorf("Expected 3 steps, got %d", len(steps))
+		}
+
+		if !tableExists(t, db, "users") || !tableExists(t, db, "groups") {
+			t.Errorf("Expected users and groups tables to exist")
+		}
+
+		steps, err = migrator.Up(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(steps) != 0 {
+			t.Errorf("Expected no steps on second run, got %d", len(steps))
+		}
+	})
+
+	t.Run("Dry run does not modify the database", func(t *testing.T) {
+		db := openTestDB(t)
+		migrator, err := NewMigrator(db, config.DBTypeSQLite, migrations, WithDryRun())
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+
+		steps, err := migrator.Up(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(steps) != 3 {
+			t.Errorf("Expected 3 planned steps, got %d", len(steps))
+		}
+
+		if tableExists(t, db, "users") {
+			t.Errorf("Expected users table to not exist")
+		}
+		if tableExists(t, db, DefaultMigrationTable) {
+			t.Errorf("Expected %s table to not exist", DefaultMigrationTable)
+		}
+
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(statuses) != 3 || statuses[0].Applied {
+			t.Errorf("Expected 3 pending migrations, got %v", statuses)
+		}
+	})
+
+	t.Run("Status does not create the migration table", func(t *testing.T) {
+		db := openTestDB(t)
+		migrator, err := NewMigrator(db, config.DBTypeSQLite, migrations)
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(statuses) != 3 || statuses[0].Applied {
+			t.Errorf("Expected 3 pending migrations, got %v", statuses)
+		}
+		if tableExists(t, db, DefaultMigrationTable) {
+			t.Errorf("Expected %s table to not exist", DefaultMigrationTable)
+		}
+	})
+
+	t.Run("MigrateTo rolls back to the given version", func(t *testing.T) {
+		db := openTestDB(t)
+		withDownMigrations := migrations[:2]
+		migrator, err := NewMigrator(db, config.DBTypeSQLite, withDownMigrations, WithMigrationTable("custom_migrations"))
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		steps, err := migrator.MigrateTo(ctx, 1)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(steps) != 1 || steps[0].Direction != MigrationDown || steps[0].Migration.Version != 2 {
+			t.Errorf("Expected a single down step for version 2, got %#v", steps)
+		}
+
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !statuses[0].Applied || statuses[1].Applied {
+			t.Errorf("Expected only version 1 to be applied, got %#v", statuses)
+		}
+		if statuses[0].AppliedAt.IsZero() {
+			t.Errorf("Expected applied migration to have a non zero AppliedAt")
+		}
+
+		if _, err := migrator.MigrateTo(ctx, 0); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if tableExists(t, db, "users") {
+			t.Errorf("Expected users table to not exist")
+		}
+	})
+
+	t.Run("MigrateTo fails when a down migration is missing", func(t *testing.T) {
+		db := openTestDB(t)
+		migrator, err := NewMigrator(db, config.DBTypeSQLite, migrations)
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if _, err := migrator.MigrateTo(ctx, 1); !errors.Is(err, ErrMissingDownMigration) {
+			t.Errorf("Expected error to be %v, got %v", ErrMissingDownMigration, err)
+		}
+	})
+
+	t.Run("MigrateTo fails on unknown version", func(t *testing.T) {
+		migrator, err := NewMigrator(openTestDB(t), config.DBTypeSQLite, migrations)
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+
+		if _, err := migrator.MigrateTo(ctx, 42); !errors.Is(err, ErrUnknownVersion) {
+			t.Errorf("Expected error to be %v, got %v", ErrUnknownVersion, err)
+		}
+	})
+
+	t.Run("Failed migrations are rolled back", func(t *testing.T) {
+		db := openTestDB(t)
+		broken := []Migration{
+			{Version: 1, Name: "broken", Up: "CREATE TABLE broken (id INTEGER); INSERT INTO unknown VALUES (1);"},
+		}
+		migrator, err := NewMigrator(db, config.DBTypeSQLite, broken)
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+
+		if _, err := migrator.Up(ctx); err == nil {
+			t.Fatalf("Expected an error, got nil")
+		}
+
+		if tableExists(t, db, "broken") {
+			t.Errorf("Expected broken table to have been rolled back")
+		}
+	})
+}
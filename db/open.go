@@ -0,0 +1,36 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+
+	// register the drivers matching the config.DBType values
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+// Open validates cfg and opens the corresponding database.
+// On SQLite, the configured pragmas are applied on every new connection of the pool.
+func Open(cfg config.DBCfg) (*sql.DB, error) {
+	dsn, err := cfg.ConnectionString()
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.Open(cfg.Type.String(), dsn)
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+func TestOpen(t *testing.T) {
+	t.Run("Open applies sqlite pragmas on every connection", func(t *testing.T) {
+		cfg := config.DBCfg{
+			Type: config.DBTypeSQLite,
+			File: filepath.Join(t.TempDir(), "test.sqlite"),
+			SQLite: config.SQLiteCfg{
+				JournalMode: config.SQLiteJournalModeWAL,
+				BusyTimeout: 1234,
+				ForeignKeys: true,
+				Synchronous: config.SQLiteSynchronousFull,
+			},
+		}
+
+		db, err := Open(cfg)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(2)
+
+		// hold a first connection open so the pragmas get checked on a second one too
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		for _, q := range []struct {
+			pragma   string
+			expected string
+		}{
+			{pragma: "journal_mode", expected: "wal"},
+			{pragma: "busy_timeout", expected: "1234"},
+			{pragma: "foreign_keys", expected: "1"},
+			{pragma: "synchronous", expected: "2"},
+		} {
+			for _, queryRow := range []func(string, ...interface{}) *sql.Row{tx.QueryRow, db.QueryRow} {
+				var value string
+				if err := queryRow("PRAGMA " + q.pragma).Scan(&value); err != nil {
+					t.Fatalf("Failed to query pragma %s: %v", q.pragma, err)
+				}
+
+				if strings.ToLower(value) != q.expected {
+					t.Errorf("Expected pragma %s to be %s, got %s", q.pragma, q.expected, value)
+				}
+			}
+		}
+	})
+
+	t.Run("Open shares in memory databases between connections", func(t *testing.T) {
+		cfg := config.DBCfg{
+			Type:   config.DBTypeSQLite,
+			File:   t.Name(),
+			SQLite: config.SQLiteCfg{SharedMemory: true},
+		}
+
+		db, err := Open(cfg)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer db.Close()
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		if _, err := tx.Exec("CREATE TABLE shared (id INTEGER)"); err != nil {
+			t.Fatalf("Failed to create table: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		// keep a connection busy so the query below runs on a new one
+		other, err := db.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer other.Rollback()
+
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM shared").Scan(&count); err != nil {
+			t.Errorf("Expected table to be visible from another connection, got %v", err)
+		}
+	})
+
+	t.Run("Open returns an error on invalid configuration", func(t *testing.T) {
+		cfg := config.DBCfg{
+			Type:   config.DBTypeSQLite,
+			File:   "test.sqlite",
+			SQLite: config.SQLiteCfg{JournalMode: "invalid"},
+		}
+
+		if _, err := Open(cfg); err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+// ReplicatedDB defines a database handle sending writes to the primary database
+// and read-only transactions to its healthy replicas, round-robin.
+// When no replica is healthy, everything is sent to the primary.
+type ReplicatedDB interface {
+	// Primary returns the primary database
+	Primary() *sql.DB
+	// Reader returns the next healthy replica, or the primary when none is available
+	Reader() *sql.DB
+	// BeginTx starts a transaction on a replica when opts is read-only, on the primary otherwise
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	// ExecContext executes a query on the primary
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	// HealthCheckers returns the checkers of every replica
+	HealthCheckers() []HealthChecker
+	// Run periodically checks the replicas health until ctx is done
+	Run(ctx context.Context)
+	// Close closes the primary and every replica
+	Close() error
+}
+
+type replicatedDB struct {
+	primary  *sql.DB
+	replicas []*sql.DB
+	checkers []HealthChecker
+	next     uint32
+}
+
+var _ ReplicatedDB = (*replicatedDB)(nil)
+
+// OpenReplicated opens the primary database and every replica from cfg.
+// The replicas health is only known once Run has been started, until then the primary is used for reads too.
+func OpenReplicated(cfg config.DBCfg, opts ...HealthCheckerOption) (ReplicatedDB, error) {
+	primary, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []*sql.DB
+	for i := range cfg.Replicas {
+		replica, err := Open(cfg.Replica(i))
+		if err != nil {
+			primary.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+
+			return nil, fmt.Errorf("failed to open replica %d: %v", i, err)
+		}
+		replicas = append(replicas, replica)
+	}
+
+	return NewReplicatedDB(primary, replicas, opts...), nil
+}
+
+// NewReplicatedDB creates a new ReplicatedDB from already opened databases.
+// The opts are applied on the health checker of every replica.
+func NewReplicatedDB(primary *sql.DB, replicas []*sql.DB, opts ...HealthCheckerOption) ReplicatedDB {
+	checkers := make([]HealthChecker, 0, len(replicas))
+	for i, replica := range replicas {
+		checkerOpts := append([]HealthCheckerOption{WithHealthCheckName(fmt.Sprintf("database-replica-%d", i))}, opts...)
+		checkers = append(checkers, NewHealthChecker(replica, checkerOpts...))
+	}
+
+	return &replicatedDB{
+		primary:  primary,
+		replicas: replicas,
+		checkers: checkers,
+	}
+}
+
+func (r *replicatedDB) Primary() *sql.DB {
+	return r.primary
+}
+
+func (r *replicatedDB) Reader() *sql.DB {
+	count := uint32(len(r.replicas))
+	for i := uint32(0); i < count; i++ {
+		index := atomic.AddUint32(&r.next, 1) % count
+		if r.checkers[index].Status().Healthy {
+			return r.replicas[index]
+		}
+	}
+
+	return r.primary
+}
+
+func (r *replicatedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if opts == nil || !opts.ReadOnly {
+		return r.primary.BeginTx(ctx, opts)
+	}
+
+	reader := r.Reader()
+	tx, err := reader.BeginTx(ctx, opts)
+	if err != nil && reader != r.primary {
+		return r.primary.BeginTx(ctx, opts)
+	}
+
+	return tx, err
+}
+
+func (r *replicatedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+func (r *replicatedDB) HealthCheckers() []HealthChecker {
+	return r.checkers
+}
+
+func (r *replicatedDB) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, checker := range r.checkers {
+		wg.Add(1)
+		go func(checker HealthChecker) {
+			defer wg.Done()
+			checker.Run(ctx)
+		}(checker)
+	}
+
+	wg.Wait()
+}
+
+func (r *replicatedDB) Close() error {
+	err := r.primary.Close()
+	for _, replica := range r.replicas {
+		if replicaErr := replica.Close(); err == nil {
+			err = replicaErr
+		}
+	}
+
+	return err
+}
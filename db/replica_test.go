@@ -0,0 +1,152 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+func TestReplicatedDB(t *testing.T) {
+	ctx := context.Background()
+
+	// openNamedDB opens an in memory database holding its name in an origin table
+	openNamedDB := func(t *testing.T, name string) *sql.DB {
+		db, err := Open(config.DBCfg{
+			Type:   config.DBTypeSQLite,
+			File:   t.Name() + name,
+			SQLite: config.SQLiteCfg{SharedMemory: true},
+		})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if _, err := db.Exec("CREATE TABLE origin (name TEXT); INSERT INTO origin VALUES (?)", name); err != nil {
+			t.Fatalf("Failed to create origin table: %v", err)
+		}
+
+		return db
+	}
+
+	readOrigin := func(t *testing.T, r ReplicatedDB, opts *sql.TxOptions) string {
+		tx, err := r.BeginTx(ctx, opts)
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		var name string
+		if err := tx.QueryRow("SELECT name FROM origin").Scan(&name); err != nil {
+			t.Fatalf("Failed to read origin: %v", err)
+		}
+
+		return name
+	}
+
+	newReplicatedDB := func(t *testing.T) (ReplicatedDB, []*sql.DB) {
+		replicas := []*sql.DB{openNamedDB(t, "replica0"), openNamedDB(t, "replica1")}
+		r := NewReplicatedDB(openNamedDB(t, "primary"), replicas)
+
+		return r, replicas
+	}
+
+	t.Run("Reads go to the primary until replicas are checked", func(t *testing.T) {
+		r, _ := newReplicatedDB(t)
+
+		if origin := readOrigin(t, r, &sql.TxOptions{ReadOnly: true}); origin != "primary" {
+			t.Errorf("Expected read to go to primary, got %s", origin)
+		}
+	})
+
+	t.Run("Read-only transactions are balanced between healthy replicas", func(t *testing.T) {
+		r, _ := newReplicatedDB(t)
+		for _, checker := range r.HealthCheckers() {
+			checker.Check(ctx)
+		}
+
+		origins := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			origins[readOrigin(t, r, &sql.TxOptions{ReadOnly: true})]++
+		}
+
+		if origins["replica0"] != 2 || origins["replica1"] != 2 {
+			t.Errorf("Expected reads to be evenly balanced between replicas, got %v", origins)
+		}
+	})
+
+	t.Run("Write transactions go to the primary", func(t *testing.T) {
+		r, _ := newReplicatedDB(t)
+		for _, checker := range r.HealthCheckers() {
+			checker.Check(ctx)
+		}
+
+		for _, opts := range []*sql.TxOptions{nil, {}} {
+			if origin := readOrigin(t, r, opts); origin != "primary" {
+				t.Errorf("Expected transaction to go to primary, got %s", origin)
+			}
+		}
+
+		if _, err := r.ExecContext(ctx, "INSERT INTO origin VALUES ('written')"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var count int
+		if err := r.Primary().QueryRow("SELECT COUNT(*) FROM origin").Scan(&count); err != nil {
+			t.Fatalf("Failed to count origins: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("Expected primary to hold 2 rows, got %d", count)
+		}
+	})
+
+	t.Run("Reads fail over when replicas are down", func(t *testing.T) {
+		r, replicas := newReplicatedDB(t)
+		for _, checker := range r.HealthCheckers() {
+			checker.Check(ctx)
+		}
+
+		replicas[0].Close()
+		r.HealthCheckers()[0].Check(ctx)
+
+		for i := 0; i < 2; i++ {
+			if origin := readOrigin(t, r, &sql.TxOptions{ReadOnly: true}); origin != "replica1" {
+				t.Errorf("Expected read to go to replica1, got %s", origin)
+			}
+		}
+
+		replicas[1].Close()
+		r.HealthCheckers()[1].Check(ctx)
+
+		if origin := readOrigin(t, r, &sql.TxOptions{ReadOnly: true}); origin != "primary" {
+			t.Errorf("Expected read to fail over to primary, got %s", origin)
+		}
+	})
+
+	t.Run("OpenReplicated rejects replicas on sqlite", func(t *testing.T) {
+		cfg := config.DBCfg{
+			Type:     config.DBTypeSQLite,
+			File:     "test.sqlite",
+			Replicas: []config.DBReplicaCfg{{Host: "replica"}},
+		}
+
+		if _, err := OpenReplicated(cfg); err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health defines the common interface of components reporting their health,
+// such as database or broker connections, to be aggregated by readiness probes.
+package health
+
+import "time"
+
+// Status holds the result of the latest checks of a component
+type Status struct {
+	// Healthy is true when the component is usable
+	Healthy bool
+	// ConsecutiveFailures is the number of failed checks since the last successful one
+	ConsecutiveFailures int
+	// LastError is the error returned by the last failed check, if any
+	LastError error
+	// LastCheck is the time of the last check, zero when the component has never been checked
+	LastCheck time.Time
+	// LastSuccess is the time of the last successful check
+	LastSuccess time.Time
+}
+
+// Checker defines a component able to report its health
+type Checker interface {
+	// Name identifies the checked component, such as "database"
+	Name() string
+	// Status returns the current health status of the component
+	Status() Status
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Phase is the lifecycle event during which a component failed
+type Phase string
+
+// List of lifecycle phases
+const (
+	PhaseStart  Phase = "start"
+	PhaseRun    Phase = "run"
+	PhaseReload Phase = "reload"
+	PhaseStop   Phase = "stop"
+)
+
+// ComponentError is returned when a component hook fails
+type ComponentError struct {
+	Component string
+	Phase     Phase
+	Err       error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("component %s failed to %s: %v", e.Component, e.Phase, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregates the errors of all the components failing during a lifecycle event,
+// in the order they occurred. It can be inspected with errors.Is and errors.As.
+type Errors []*ComponentError
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("%d lifecycle errors: %s", len(e), strings.Join(messages, "; "))
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// err returns e as an error, or nil when empty
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
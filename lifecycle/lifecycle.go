@@ -0,0 +1,365 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lifecycle starts and gracefully stops the components of the server applications,
+// such as database connections, gRPC, HTTP and MQTT servers, in their dependency order.
+//
+//	manager := lifecycle.NewManager(lifecycle.WithLogger(logger.Logger))
+//	manager.Register(
+//		lifecycle.Component{Name: "database", Start: openDB, Stop: closeDB},
+//		lifecycle.Component{Name: "grpc", DependsOn: []string{"database"}, Start: startGRPC, Stop: stopGRPC},
+//		lifecycle.Component{Name: "config", Reload: reloadConfig},
+//	)
+//
+//	// Blocks until SIGINT or SIGTERM, reloading the components on SIGHUP
+//	if err := manager.Run(context.Background()); err != nil {
+//		logger.Error("server failed", "error", err)
+//		os.Exit(1)
+//	}
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultStopTimeout is the default maximum duration of a component Stop hook
+	DefaultStopTimeout = 10 * time.Second
+	// DefaultShutdownTimeout is the default maximum duration of the whole shutdown
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+var (
+	// ErrAlreadyStarted is returned when registering or starting components of a started Manager
+	ErrAlreadyStarted = errors.New("lifecycle already started")
+	// ErrDuplicateComponent is returned when registering two components with the same name
+	ErrDuplicateComponent = errors.New("duplicate component")
+	// ErrUnknownDependency is returned when a component depends on an unregistered component
+	ErrUnknownDependency = errors.New("unknown dependency")
+	// ErrDependencyCycle is returned when components depend on each other
+	ErrDependencyCycle = errors.New("dependency cycle")
+)
+
+// Hook is a function called on a lifecycle event of a component.
+// Start hooks must return once the component is started, running servers in their own goroutine.
+type Hook func(ctx context.Context) error
+
+// Component holds the lifecycle hooks of a part of the application
+type Component struct {
+	// Name identifies the component, such as "database"
+	Name string
+	// DependsOn lists the names of the components started before this one, and stopped after it
+	DependsOn []string
+	// Start is called on startup, optional
+	Start Hook
+	// Stop is called on shutdown if the component started, optional.
+	// Its context is done once the stop timeout is reached.
+	Stop Hook
+	// Reload is called on SIGHUP if the component started, optional
+	Reload Hook
+	// StopTimeout overrides the default stop timeout of the Manager when not zero
+	StopTimeout time.Duration
+}
+
+// Manager starts, reloads and stops registered components
+type Manager interface {
+	// Register adds components to the manager. They can be registered in any order,
+	// as long as their dependencies are all registered before Start.
+	Register(components ...Component) error
+	// Start starts the components in their dependency order. When one fails to start,
+	// the already started ones are stopped and the errors are returned.
+	Start(ctx context.Context) error
+	// Stop stops the started components in the reverse order, within the shutdown timeout.
+	// It returns the aggregated Errors of the components failing to stop.
+	Stop(ctx context.Context) error
+	// Reload calls the Reload hook of the started components, in their start order
+	Reload(ctx context.Context) error
+	// Fail reports a component failing after its start, such as a server unable to serve,
+	// which makes Run stop all the components.
+	Fail(component string, err error)
+	// Run starts the components and stops them once ctx is done, a shutdown signal is received
+	// or a component failed. SIGHUP signals reload the components meanwhile. A second shutdown
+	// signal cancels the ongoing shutdown.
+	Run(ctx context.Context) error
+}
+
+// ManagerOption defines functions able to alter a Manager
+type ManagerOption func(*manager)
+
+// WithStopTimeout overrides the DefaultStopTimeout
+func WithStopTimeout(timeout time.Duration) ManagerOption {
+	return func(m *manager) {
+		m.stopTimeout = timeout
+	}
+}
+
+// WithShutdownTimeout overrides the DefaultShutdownTimeout
+func WithShutdownTimeout(timeout time.Duration) ManagerOption {
+	return func(m *manager) {
+		m.shutdownTimeout = timeout
+	}
+}
+
+// WithShutdownSignals overrides the default SIGINT and SIGTERM signals stopping Run
+func WithShutdownSignals(signals ...os.Signal) ManagerOption {
+	return func(m *manager) {
+		m.shutdownSignals = signals
+	}
+}
+
+// WithLogger overrides the default slog logger
+func WithLogger(logger *slog.Logger) ManagerOption {
+	return func(m *manager) {
+		m.logger = logger
+	}
+}
+
+type manager struct {
+	stopTimeout     time.Duration
+	shutdownTimeout time.Duration
+	shutdownSignals []os.Signal
+	logger          *slog.Logger
+
+	lock       sync.Mutex
+	components []*Component
+	started    []*Component
+	running    bool
+
+	failures chan *ComponentError
+}
+
+var _ Manager = (*manager)(nil)
+
+// NewManager creates a new Manager without any component
+func NewManager(opts ...ManagerOption) Manager {
+	m := &manager{
+		stopTimeout:     DefaultStopTimeout,
+		shutdownTimeout: DefaultShutdownTimeout,
+		shutdownSignals: defaultShutdownSignals(),
+		logger:          slog.Default(),
+		failures:        make(chan *ComponentError, 1),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+func (m *manager) Register(components ...Component) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.running {
+		return ErrAlreadyStarted
+	}
+
+	for i := range components {
+		c := components[i]
+		if c.Name == "" {
+			return errors.New("component name is required")
+		}
+		if m.component(c.Name) != nil {
+			return fmt.Errorf("%w %q", ErrDuplicateComponent, c.Name)
+		}
+
+		m.components = append(m.components, &c)
+	}
+
+	return nil
+}
+
+func (m *manager) Start(ctx context.Context) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.running {
+		return ErrAlreadyStarted
+	}
+
+	ordered, err := m.order()
+	if err != nil {
+		return err
+	}
+
+	m.running = true
+	for _, c := range ordered {
+		if c.Start != nil {
+			begin := time.Now()
+			if err := c.Start(ctx); err != nil {
+				m.logger.Error("component failed to start", "component", c.Name, "error", err)
+
+				errs := Errors{{Component: c.Name, Phase: PhaseStart, Err: err}}
+
+				return append(errs, m.stop(context.Background())...)
+			}
+			m.logger.Info("component started", "component", c.Name, "duration", time.Since(begin))
+		}
+
+		m.started = append(m.started, c)
+	}
+
+	return nil
+}
+
+func (m *manager) Stop(ctx context.Context) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.stop(ctx).err()
+}
+
+// stop stops the started components in the reverse order, expected to be called with the lock held
+func (m *manager) stop(ctx context.Context) Errors {
+	ctx, cancel := context.WithTimeout(ctx, m.shutdownTimeout)
+	defer cancel()
+
+	var errs Errors
+	for i := len(m.started) - 1; i >= 0; i-- {
+		c := m.started[i]
+		if c.Stop == nil {
+			continue
+		}
+
+		timeout := m.stopTimeout
+		if c.StopTimeout > 0 {
+			timeout = c.StopTimeout
+		}
+
+		begin := time.Now()
+		if err := callHook(ctx, timeout, c.Stop); err != nil {
+			m.logger.Error("component failed to stop", "component", c.Name, "error", err)
+			errs = append(errs, &ComponentError{Component: c.Name, Phase: PhaseStop, Err: err})
+			continue
+		}
+		m.logger.Info("component stopped", "component", c.Name, "duration", time.Since(begin))
+	}
+
+	m.started = nil
+	m.running = false
+
+	return errs
+}
+
+func (m *manager) Reload(ctx context.Context) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var errs Errors
+	for _, c := range m.started {
+		if c.Reload == nil {
+			continue
+		}
+
+		if err := c.Reload(ctx); err != nil {
+			m.logger.Error("component failed to reload", "component", c.Name, "error", err)
+			errs = append(errs, &ComponentError{Component: c.Name, Phase: PhaseReload, Err: err})
+			continue
+		}
+		m.logger.Info("component reloaded", "component", c.Name)
+	}
+
+	return errs.err()
+}
+
+func (m *manager) Fail(component string, err error) {
+	m.logger.Error("component failed", "component", component, "error", err)
+
+	// Only the first failure is kept, as it triggers the shutdown
+	select {
+	case m.failures <- &ComponentError{Component: component, Phase: PhaseRun, Err: err}:
+	default:
+	}
+}
+
+// order returns the components sorted so that each one comes after its dependencies,
+// keeping the registration order otherwise.
+func (m *manager) order() ([]*Component, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	states := make(map[string]int)
+	var ordered []*Component
+
+	var visit func(c *Component, path []string) error
+	visit = func(c *Component, path []string) error {
+		switch states[c.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(append(path, c.Name), " -> "))
+		}
+
+		states[c.Name] = visiting
+		for _, name := range c.DependsOn {
+			dependency := m.component(name)
+			if dependency == nil {
+				return fmt.Errorf("%w %q required by %q", ErrUnknownDependency, name, c.Name)
+			}
+			if err := visit(dependency, append(path, c.Name)); err != nil {
+				return err
+			}
+		}
+		states[c.Name] = visited
+		ordered = append(ordered, c)
+
+		return nil
+	}
+
+	for _, c := range m.components {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+func (m *manager) component(name string) *Component {
+	for _, c := range m.components {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// callHook calls hook with a context done after timeout, or when ctx is done.
+// It returns the context error without waiting for hooks ignoring their context.
+func callHook(ctx context.Context, timeout time.Duration, hook Hook) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- hook(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recorder records the hooks called on test components
+type recorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recorder) hook(event string, err error) Hook {
+	return func(ctx context.Context) error {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		r.events = append(r.events, event)
+
+		return err
+	}
+}
+
+func (r *recorder) component(name string, dependsOn ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start:     r.hook("start "+name, nil),
+		Stop:      r.hook("stop "+name, nil),
+		Reload:    r.hook("reload "+name, nil),
+	}
+}
+
+func (r *recorder) assertEvents(t *testing.T, expected ...string) {
+	t.Helper()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !reflect.DeepEqual(r.events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, r.events)
+	}
+	r.events = nil
+}
+
+func newTestManager(opts ...ManagerOption) Manager {
+	return NewManager(append([]ManagerOption{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)...)
+}
+
+func TestManager(t *testing.T) {
+	t.Run("components start in dependency order and stop in reverse", func(t *testing.T) {
+		r := &recorder{}
+		m := newTestManager()
+		if err := m.Register(r.component("grpc", "database", "broker"), r.component("broker"), r.component("database")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if err := m.Start(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		r.assertEvents(t, "start database", "start broker", "start grpc")
+
+		if err := m.Start(context.Background()); err != ErrAlreadyStarted {
+			t.Errorf("Expected ErrAlreadyStarted, got %v", err)
+		}
+		if err := m.Register(r.component("http")); err != ErrAlreadyStarted {
+			t.Errorf("Expected ErrAlreadyStarted, got %v", err)
+		}
+
+		if err := m.Reload(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		r.assertEvents(t, "reload database", "reload broker", "reload grpc")
+
+		if err := m.Stop(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		r.assertEvents(t, "stop grpc", "stop broker", "stop database")
+	})
+
+	t.Run("invalid registrations", func(t *testing.T) {
+		r := &recorder{}
+
+		m := newTestManager()
+		if err := m.Register(r.component("database"), r.component("database")); !errors.Is(err, ErrDuplicateComponent) {
+			t.Errorf("Expected ErrDuplicateComponent, got %v", err)
+		}
+		if err := m.Register(Component{}); err == nil {
+			t.Error("Expected an error on missing name")
+		}
+
+		m = newTestManager()
+		m.Register(r.component("grpc", "database"))
+		if err := m.Start(context.Background()); !errors.Is(err, ErrUnknownDependency) {
+			t.Errorf("Expected ErrUnknownDependency, got %v", err)
+		}
+
+		m = newTestManager()
+		m.Register(r.component("a", "b"), r.component("b", "c"), r.component("c", "a"))
+		err := m.Start(context.Background())
+		if !errors.Is(err, ErrDependencyCycle) {
+			t.Errorf("Expected ErrDependencyCycle, got %v", err)
+		}
+		if err.Error() != "dependency cycle: a -> b -> c -> a" {
+			t.Errorf("Unexpected cycle error %q", err)
+		}
+
+		r.assertEvents(t)
+	})
+
+	t.Run("start failure stops the started components", func(t *testing.T) {
+		r := &recorder{}
+		errStart := errors.New("start failed")
+		errStop := errors.New("stop failed")
+
+		broker := r.component("broker", "database")
+		broker.Start = r.hook("start broker", errStart)
+		database := r.component("database")
+		database.Stop = r.hook("stop database", errStop)
+
+		m := newTestManager()
+		m.Register(database, broker, r.component("grpc", "broker"))
+
+		err := m.Start(context.Background())
+		r.assertEvents(t, "start database", "start broker", "stop database")
+
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) != 2 {
+			t.Fatalf("Expected 2 aggregated errors, got %v", err)
+		}
+		if errs[0].Component != "broker" || errs[0].Phase != PhaseStart || !errors.Is(err, errStart) {
+			t.Errorf("Unexpected start error %v", errs[0])
+		}
+		if errs[1].Component != "database" || errs[1].Phase != PhaseStop || !errors.Is(err, errStop) {
+			t.Errorf("Unexpected stop error %v", errs[1])
+		}
+
+		// The manager can be started again once the failure is fixed
+		m = newTestManager()
+		m.Register(database)
+		if err := m.Start(context.Background()); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("stop timeouts", func(t *testing.T) {
+		blocking := func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		}
+
+		r := &recorder{}
+		m := newTestManager(WithStopTimeout(20*time.Millisecond), WithShutdownTimeout(time.Minute))
+		m.Register(
+			r.component("database"),
+			Component{Name: "grpc", DependsOn: []string{"database"}, Stop: blocking},
+			Component{Name: "http", DependsOn: []string{"database"}, Stop: blocking, StopTimeout: 50 * time.Millisecond},
+		)
+		m.Start(context.Background())
+		r.assertEvents(t, "start database")
+
+		begin := time.Now()
+		err := m.Stop(context.Background())
+		if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected stop to return after the timeouts, took %v", elapsed)
+		}
+		r.assertEvents(t, "stop database")
+
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) != 2 {
+			t.Fatalf("Expected 2 aggregated errors, got %v", err)
+		}
+		if errs[0].Component != "http" || errs[1].Component != "grpc" || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Unexpected errors %v", err)
+		}
+
+		// The shutdown timeout bounds the sum of the component timeouts
+		m = newTestManager(WithStopTimeout(time.Minute), WithShutdownTimeout(20*time.Millisecond))
+		m.Register(Component{Name: "grpc", Stop: blocking}, Component{Name: "http", Stop: blocking})
+		m.Start(context.Background())
+
+		begin = time.Now()
+		m.Stop(context.Background())
+		if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected stop to return after the shutdown timeout, took %v", elapsed)
+		}
+	})
+
+	t.Run("reload errors are aggregated", func(t *testing.T) {
+		r := &recorder{}
+		errReload := errors.New("reload failed")
+		config := Component{Name: "config", Reload: r.hook("reload config", errReload)}
+
+		m := newTestManager()
+		m.Register(config, r.component("database"))
+		m.Start(context.Background())
+
+		err := m.Reload(context.Background())
+		r.assertEvents(t, "start database", "reload config", "reload database")
+		if !errors.Is(err, errReload) {
+			t.Errorf("Expected reload error, got %v", err)
+		}
+	})
+}
+
+func TestManagerRun(t *testing.T) {
+	t.Run("context cancellation", func(t *testing.T) {
+		r := &recorder{}
+		m := newTestManager()
+		m.Register(r.component("database"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if err := m.Run(ctx); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		r.assertEvents(t, "start database", "stop database")
+	})
+
+	t.Run("component failure", func(t *testing.T) {
+		r := &recorder{}
+		m := newTestManager()
+		errServe := errors.New("listener closed")
+		m.Register(r.component("database"), Component{
+			Name:      "http",
+			DependsOn: []string{"database"},
+			Start: func(ctx context.Context) error {
+				go m.Fail("http", errServe)
+				return nil
+			},
+		})
+
+		err := m.Run(context.Background())
+		r.assertEvents(t, "start database", "stop database")
+
+		var componentErr *ComponentError
+		if !errors.As(err, &componentErr) || componentErr.Component != "http" || componentErr.Phase != PhaseRun || !errors.Is(err, errServe) {
+			t.Errorf("Expected the http failure, got %v", err)
+		}
+	})
+
+	t.Run("signals", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("signals are not supported on windows")
+		}
+
+		r := &recorder{}
+		reloaded := make(chan struct{})
+		started := make(chan struct{})
+		m := newTestManager()
+		m.Register(r.component("database"), Component{
+			Name:   "config",
+			Start:  func(context.Context) error { close(started); return nil },
+			Reload: func(context.Context) error { close(reloaded); return nil },
+		})
+
+		result := make(chan error)
+		go func() {
+			result <- m.Run(context.Background())
+		}()
+
+		process, _ := os.FindProcess(os.Getpid())
+		<-started
+		process.Signal(syscall.SIGHUP)
+		select {
+		case <-reloaded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected SIGHUP to reload the components")
+		}
+
+		process.Signal(syscall.SIGTERM)
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected SIGTERM to stop the components")
+		}
+		r.assertEvents(t, "start database", "reload database", "stop database")
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadSignal is the signal reloading the components
+var reloadSignal os.Signal = syscall.SIGHUP
+
+func defaultShutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM}
+}
+
+func (m *manager) Run(ctx context.Context) error {
+	// Signals are handled before the start, so that none is missed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{reloadSignal}, m.shutdownSignals...)...)
+	defer signal.Stop(signals)
+
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+
+	var errs Errors
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Info("shutting down", "reason", ctx.Err())
+			break wait
+		case failure := <-m.failures:
+			errs = append(errs, failure)
+			m.logger.Info("shutting down", "reason", "component failure")
+			break wait
+		case sig := <-signals:
+			if sig == reloadSignal {
+				m.logger.Info("reloading", "signal", sig.String())
+				m.Reload(ctx)
+				continue
+			}
+
+			m.logger.Info("shutting down", "signal", sig.String())
+			break wait
+		}
+	}
+
+	stopCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == reloadSignal {
+					continue
+				}
+				m.logger.Warn("forcing shutdown", "signal", sig.String())
+				cancel()
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	m.lock.Lock()
+	errs = append(errs, m.stop(stopCtx)...)
+	m.lock.Unlock()
+
+	return errs.err()
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// consoleTimeFormat is the time layout of the console format
+const consoleTimeFormat = "2006-01-02 15:04:05.000"
+
+// consoleHandler is a slog.Handler writing human readable lines, such as
+//
+//	2020-06-01 12:00:00.000 INFO  server started addr=:8080
+type consoleHandler struct {
+	opts *slog.HandlerOptions
+
+	lock *sync.Mutex
+	w    io.Writer
+
+	// attrs holds the formatted attributes added with WithAttrs
+	attrs string
+	// group is the key prefix of the attributes, from WithGroup
+	group string
+}
+
+var _ slog.Handler = (*consoleHandler)(nil)
+
+func newConsoleHandler(w io.Writer, opts *slog.HandlerOptions) *consoleHandler {
+	return &consoleHandler{
+		opts: opts,
+		lock: &sync.Mutex{},
+		w:    w,
+	}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+
+	return level >= minLevel
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b bytes.Buffer
+
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format(consoleTimeFormat))
+		b.WriteByte(' ')
+	}
+	fmt.Fprintf(&b, "%-5s %s", r.Level.String(), r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(attr slog.Attr) bool {
+		appendConsoleAttr(&b, h.group, attr)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	_, err := h.w.Write(b.Bytes())
+
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b bytes.Buffer
+	for _, attr := range attrs {
+		appendConsoleAttr(&b, h.group, attr)
+	}
+
+	clone := *h
+	clone.attrs += b.String()
+
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	clone := *h
+	clone.group += name + "."
+
+	return &clone
+}
+
+func appendConsoleAttr(b *bytes.Buffer, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			appendConsoleAttr(b, prefix, groupAttr)
+		}
+		return
+	}
+
+	var value string
+	switch attr.Value.Kind() {
+	case slog.KindTime:
+		value = attr.Value.Time().Format(time.RFC3339Nano)
+	default:
+		value = attr.Value.String()
+	}
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(prefix)
+	b.WriteString(attr.Key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
@@ -0,0 +1,330 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging builds the structured loggers of the server applications from their configuration,
+// so every service shares the same levels, formats and outputs.
+//
+//	var logCfg logging.LoggerCfg
+//	loader.Load(logCfg.ViperCfgFields())
+//
+//	logger, err := logging.New(logCfg, pathResolver, logging.WithStaticFields("service", "c2", "version", version))
+//	defer logger.Close()
+//
+// The returned Logger embeds a *slog.Logger, whose level can be changed at runtime with SetLevel.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/path"
+)
+
+// List of supported log formats
+const (
+	// FormatJSON writes one JSON object per line
+	FormatJSON = "json"
+	// FormatLogfmt writes key=value pairs per line
+	FormatLogfmt = "logfmt"
+	// FormatConsole writes human readable lines, for development
+	FormatConsole = "console"
+)
+
+// List of special log outputs, any other value being a file path
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// LogFileMode is the mode of the created log files
+const LogFileMode os.FileMode = 0640
+
+// LoggerCfg holds the logging configuration
+type LoggerCfg struct {
+	// Level is one of debug, info, warn or error
+	Level  string
+	Format string
+	// Output is stdout, stderr or a file path, relative to the configuration directory
+	Output string
+	// SamplingInitial is the number of identical messages logged each second before sampling starts.
+	// Sampling is disabled when zero.
+	SamplingInitial int
+	// SamplingThereafter is the rate of identical messages logged once sampling started, one every
+	// SamplingThereafter messages, or none when zero.
+	SamplingThereafter int
+	// Fields lists key=value pairs added to every log
+	Fields []string
+	// RotateMaxSize is the size in megabytes of a file output triggering its rotation, disabled when zero
+	RotateMaxSize int
+	// RotateMaxAge is the age of a file output triggering its rotation, such as 24h, disabled when empty
+	RotateMaxAge string
+	// RotateMaxFiles is the number of rotated files kept, unlimited when zero
+	RotateMaxFiles int
+	// RotateCompress enables the gzip compression of the rotated files
+	RotateCompress bool
+}
+
+// ViperCfgFields returns the list of configuration fields needed to load a LoggerCfg
+func (c *LoggerCfg) ViperCfgFields() []config.ViperCfgField {
+	return []config.ViperCfgField{
+		{Target: &c.Level, KeyName: "log-level", CfgType: config.ViperString, DefaultValue: "info", EnvMapping: "LOG_LEVEL"},
+		{Target: &c.Format, KeyName: "log-format", CfgType: config.ViperString, DefaultValue: FormatJSON},
+		{Target: &c.Output, KeyName: "log-output", CfgType: config.ViperString, DefaultValue: OutputStderr},
+		{Target: &c.SamplingInitial, KeyName: "log-sampling-initial", CfgType: config.ViperInt, DefaultValue: 0},
+		{Target: &c.SamplingThereafter, KeyName: "log-sampling-thereafter", CfgType: config.ViperInt, DefaultValue: 0},
+		{Target: &c.Fields, KeyName: "log-fields", CfgType: config.ViperStringSlice, DefaultValue: []string{}},
+		{Target: &c.RotateMaxSize, KeyName: "log-rotate-max-size", CfgType: config.ViperInt, DefaultValue: 100},
+		{Target: &c.RotateMaxAge, KeyName: "log-rotate-max-age", CfgType: config.ViperString, DefaultValue: ""},
+		{Target: &c.RotateMaxFiles, KeyName: "log-rotate-max-files", CfgType: config.ViperInt, DefaultValue: 10},
+		{Target: &c.RotateCompress, KeyName: "log-rotate-compress", CfgType: config.ViperBool, DefaultValue: false},
+	}
+}
+
+// Validate checks the configuration is usable
+func (c LoggerCfg) Validate() error {
+	if _, err := ParseLevel(c.Level); err != nil {
+		return err
+	}
+
+	switch c.Format {
+	case FormatJSON, FormatLogfmt, FormatConsole:
+	default:
+		return fmt.Errorf("unsupported log format %q, must be one of %s, %s, %s", c.Format, FormatJSON, FormatLogfmt, FormatConsole)
+	}
+
+	if c.Output == "" {
+		return fmt.Errorf("log output is required")
+	}
+	if c.SamplingInitial < 0 || c.SamplingThereafter < 0 {
+		return fmt.Errorf("log sampling values must be positive")
+	}
+
+	if _, err := c.fields(); err != nil {
+		return err
+	}
+
+	if _, err := c.rotateOptions(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rotateOptions returns the rotation settings of file outputs
+func (c LoggerCfg) rotateOptions() (rotateOptions, error) {
+	if c.RotateMaxSize < 0 || c.RotateMaxFiles < 0 {
+		return rotateOptions{}, fmt.Errorf("log rotation values must be positive")
+	}
+
+	var maxAge time.Duration
+	if c.RotateMaxAge != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(c.RotateMaxAge); err != nil || maxAge < 0 {
+			return rotateOptions{}, fmt.Errorf("invalid log rotation max age %q", c.RotateMaxAge)
+		}
+	}
+
+	return rotateOptions{
+		maxSize:  int64(c.RotateMaxSize) * 1024 * 1024,
+		maxAge:   maxAge,
+		maxFiles: c.RotateMaxFiles,
+		compress: c.RotateCompress,
+	}, nil
+}
+
+// fields returns the Fields as slog arguments
+func (c LoggerCfg) fields() ([]interface{}, error) {
+	var args []interface{}
+	for _, field := range c.Fields {
+		i := strings.IndexByte(field, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid log field %q, expected key=value", field)
+		}
+		args = append(args, field[:i], field[i+1:])
+	}
+
+	return args, nil
+}
+
+// ParseLevel returns the slog.Level of a debug, info, warn or error level name
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unsupported log level %q, must be one of debug, info, warn, error", level)
+	}
+
+	return l, nil
+}
+
+// Option defines functions able to alter a Logger
+type Option func(*options)
+
+type options struct {
+	staticFields []interface{}
+}
+
+// WithStaticFields adds key value pairs to every log, such as the service name and version
+func WithStaticFields(args ...interface{}) Option {
+	return func(o *options) {
+		o.staticFields = append(o.staticFields, args...)
+	}
+}
+
+// Logger is a structured logger whose level can be changed at runtime
+type Logger struct {
+	*slog.Logger
+
+	level *slog.LevelVar
+	file  *rotatingFile
+	// sighup receives the SIGHUP signals reopening the file
+	sighup chan os.Signal
+	done   chan struct{}
+	// stopOnce stops the SIGHUP handling on the first Close
+	stopOnce sync.Once
+}
+
+// New validates cfg and returns a new Logger. File outputs are resolved from the configuration directory
+// of resolver, which can be nil when only stdout and stderr or absolute paths are used.
+// File outputs are rotated according to the Rotate settings, and reopened on SIGHUP, so external
+// tools such as logrotate can be used instead.
+func New(cfg LoggerCfg, resolver path.ConfigDirResolver, opts ...Option) (*Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	level, _ := ParseLevel(cfg.Level)
+	fields, _ := cfg.fields()
+	rotateOpts, _ := cfg.rotateOptions()
+
+	l := &Logger{level: new(slog.LevelVar)}
+	l.level.Set(level)
+
+	var w io.Writer
+	switch cfg.Output {
+	case OutputStdout:
+		w = os.Stdout
+	case OutputStderr:
+		w = os.Stderr
+	default:
+		filename := cfg.Output
+		if resolver != nil {
+			var err error
+			if filename, err = path.ResolveConfigPath(resolver, cfg.Output); err != nil {
+				return nil, fmt.Errorf("invalid log output: %w", err)
+			}
+		}
+
+		f, err := newRotatingFile(filename, rotateOpts)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+		l.file = f
+	}
+
+	var handler slog.Handler
+	handlerOptions := &slog.HandlerOptions{Level: l.level}
+	switch cfg.Format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	case FormatLogfmt:
+		handler = slog.NewTextHandler(w, handlerOptions)
+	case FormatConsole:
+		handler = newConsoleHandler(w, handlerOptions)
+	}
+
+	if cfg.SamplingInitial > 0 {
+		handler = newSamplingHandler(handler, cfg.SamplingInitial, cfg.SamplingThereafter)
+	}
+
+	l.Logger = slog.New(handler).With(append(o.staticFields, fields...)...)
+	if l.file != nil {
+		l.reopenOnSIGHUP()
+	}
+
+	return l, nil
+}
+
+// SetLevel changes the minimum level of the logs, given a debug, info, warn or error level name
+func (l *Logger) SetLevel(level string) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	l.level.Set(parsed)
+
+	return nil
+}
+
+// Level returns the current minimum level of the logs
+func (l *Logger) Level() slog.Level {
+	return l.level.Level()
+}
+
+// Reopen closes and opens the log file again, if any
+func (l *Logger) Reopen() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Reopen()
+}
+
+// Close closes the log file, if any. Closing an already closed Logger does nothing.
+func (l *Logger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	l.stopOnce.Do(func() {
+		signal.Stop(l.sighup)
+		close(l.done)
+	})
+
+	return l.file.Close()
+}
+
+func (l *Logger) reopenOnSIGHUP() {
+	l.sighup = make(chan os.Signal, 1)
+	l.done = make(chan struct{})
+	signal.Notify(l.sighup, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-l.sighup:
+				// the current file is kept open on failure, so the error can be logged to it
+				if err := l.file.Reopen(); err != nil {
+					l.Error("failed to reopen log file", "error", err)
+				}
+			case <-l.done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teserakt-io/serverlib/config/configtest"
+)
+
+func TestLoggerCfg(t *testing.T) {
+	t.Run("fields are loaded with defaults", func(t *testing.T) {
+		var cfg LoggerCfg
+		fields := cfg.ViperCfgFields()
+		configtest.MustLoad(t, configtest.NewLoader(t, "yaml", "log-format: console\nlog-fields: [\"env=dev\"]\n"), fields)
+
+		configtest.AssertFields(t, fields, map[string]interface{}{
+			"log-level":  "info",
+			"log-format": FormatConsole,
+			"log-output": OutputStderr,
+			"log-fields": []string{"env=dev"},
+		})
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("invalid configurations", func(t *testing.T) {
+		valid := LoggerCfg{Level: "info", Format: FormatJSON, Output: OutputStderr}
+		for name, alter := range map[string]func(c *LoggerCfg){
+			"level":    func(c *LoggerCfg) { c.Level = "verbose" },
+			"format":   func(c *LoggerCfg) { c.Format = "xml" },
+			"output":   func(c *LoggerCfg) { c.Output = "" },
+			"sampling": func(c *LoggerCfg) { c.SamplingInitial = -1 },
+			"fields":   func(c *LoggerCfg) { c.Fields = []string{"novalue"} },
+			"max size": func(c *LoggerCfg) { c.RotateMaxSize = -1 },
+			"max age":  func(c *LoggerCfg) { c.RotateMaxAge = "daily" },
+		} {
+			cfg := valid
+			alter(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Errorf("Expected an error on invalid %s", name)
+			}
+		}
+	})
+}
+
+func TestLogger(t *testing.T) {
+	resolver := configtest.NewTempResolver(t, nil)
+
+	newLogger := func(t *testing.T, cfg LoggerCfg, opts ...Option) (*Logger, func() string) {
+		t.Helper()
+
+		cfg.Output = strings.ReplaceAll(t.Name(), "/", "_") + ".log"
+		logger, err := New(cfg, resolver, opts...)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		t.Cleanup(func() { logger.Close() })
+
+		return logger, func() string {
+			content, err := os.ReadFile(resolver.ConfigRelativePath(cfg.Output))
+			if err != nil {
+				t.Fatalf("failed to read log file: %v", err)
+			}
+			return string(content)
+		}
+	}
+
+	t.Run("Close can be called several times", func(t *testing.T) {
+		logger, _ := newLogger(t, LoggerCfg{Level: "info", Format: FormatLogfmt})
+		for i := 0; i < 2; i++ {
+			if err := logger.Close(); err != nil {
+				t.Errorf("Expected no error on close %d, got %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("json format with static fields", func(t *testing.T) {
+		logger, output := newLogger(t, LoggerCfg{Level: "info", Format: FormatJSON, Fields: []string{"env=dev"}}, WithStaticFields("service", "test", "version", "1.0"))
+		logger.Info("started", "port", 8080)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(output()), &entry); err != nil {
+			t.Fatalf("Expected a JSON log, got %v", err)
+		}
+		for key, expected := range map[string]interface{}{
+			"msg":     "started",
+			"level":   "INFO",
+			"service": "test",
+			"version": "1.0",
+			"env":     "dev",
+			"port":    float64(8080),
+		} {
+			if entry[key] != expected {
+				t.Errorf("Expected %s to be %v, got %v", key, expected, entry[key])
+			}
+		}
+	})
+
+	t.Run("logfmt format", func(t *testing.T) {
+		logger, output := newLogger(t, LoggerCfg{Level: "info", Format: FormatLogfmt})
+		logger.Info("started", "addr", ":8080")
+
+		if !strings.Contains(output(), `level=INFO msg=started addr=:8080`) {
+			t.Errorf("Unexpected logfmt output: %s", output())
+		}
+	})
+
+	t.Run("console format", func(t *testing.T) {
+		logger, output := newLogger(t, LoggerCfg{Level: "info", Format: FormatConsole})
+		logger.With("component", "db").WithGroup("query").Warn("slow query", "duration", time.Second, "sql", "SELECT 1")
+
+		if !strings.Contains(output(), `WARN  slow query component=db query.duration=1s query.sql="SELECT 1"`) {
+			t.Errorf("Unexpected console output: %s", output())
+		}
+	})
+
+	t.Run("level changes at runtime", func(t *testing.T) {
+		logger, output := newLogger(t, LoggerCfg{Level: "warn", Format: FormatLogfmt})
+		logger.Info("hidden")
+		if err := logger.SetLevel("debug"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		logger.Debug("visible")
+
+		if logger.Level() != slog.LevelDebug {
+			t.Errorf("Expected level to be debug, got %v", logger.Level())
+		}
+		if strings.Contains(output(), "hidden") || !strings.Contains(output(), "visible") {
+			t.Errorf("Unexpected output: %s", output())
+		}
+		if err := logger.SetLevel("verbose"); err == nil {
+			t.Error("Expected an error on unknown level")
+		}
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		logger, output := newLogger(t, LoggerCfg{Level: "info", Format: FormatLogfmt, SamplingInitial: 2, SamplingThereafter: 3})
+		for i := 0; i < 10; i++ {
+			logger.Info("repeated", "i", i)
+		}
+		logger.Info("other")
+
+		// logged: 2 initial ones, then the 3rd and 6th of the 8 following ones
+		for _, i := range []string{"i=0", "i=1", "i=4", "i=7"} {
+			if !strings.Contains(output(), i) {
+				t.Errorf("Expected %s to be logged, got %s", i, output())
+			}
+		}
+		if count := strings.Count(output(), "repeated"); count != 4 {
+			t.Errorf("Expected 4 sampled logs, got %d", count)
+		}
+		if !strings.Contains(output(), "other") {
+			t.Errorf("Expected other messages not to be sampled")
+		}
+	})
+}
+
+func TestSampler(t *testing.T) {
+	now := time.Now()
+	s := &sampler{initial: 1, thereafter: 0, now: func() time.Time { return now }, counts: make(map[samplingKey]int)}
+
+	if !s.sample(slog.LevelInfo, "msg") || s.sample(slog.LevelInfo, "msg") {
+		t.Error("Expected only the first message to be logged")
+	}
+	if !s.sample(slog.LevelError, "msg") {
+		t.Error("Expected levels to be sampled separately")
+	}
+
+	now = now.Add(samplingWindow)
+	if !s.sample(slog.LevelInfo, "msg") {
+		t.Error("Expected counters to be reset on a new window")
+	}
+}
+
+func TestConsoleHandlerEnabled(t *testing.T) {
+	var b bytes.Buffer
+	h := newConsoleHandler(&b, &slog.HandlerOptions{Level: slog.LevelWarn})
+
+	if h.Enabled(context.Background(), slog.LevelInfo) || !h.Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected only levels above warn to be enabled")
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the suffix of the rotated files, sorting them chronologically
+const rotatedTimeFormat = "20060102T150405.000"
+
+// compressedSuffix is the suffix of the compressed rotated files
+const compressedSuffix = ".gz"
+
+// rotateOptions holds the rotation settings of a rotatingFile
+type rotateOptions struct {
+	// maxSize is the size in bytes triggering a rotation, disabled when zero
+	maxSize int64
+	// maxAge is the age of the file triggering a rotation, disabled when zero
+	maxAge time.Duration
+	// maxFiles is the number of rotated files kept, unlimited when zero
+	maxFiles int
+	compress bool
+}
+
+// rotatingFile is an io.WriteCloser appending to a file, which is renamed with a timestamp suffix
+// once it exceeds its maximum size or age. The oldest rotated files are removed, and the others
+// optionally compressed in the background.
+type rotatingFile struct {
+	filename string
+	opts     rotateOptions
+	now      func() time.Time
+	rename   func(oldpath, newpath string) error
+
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// background holds the pending compression and cleanup
+	background  sync.WaitGroup
+	cleanupLock sync.Mutex
+}
+
+var _ io.WriteCloser = (*rotatingFile)(nil)
+
+func newRotatingFile(filename string, opts rotateOptions) (*rotatingFile, error) {
+	r := &rotatingFile{
+		filename: filename,
+		opts:     opts,
+		now:      time.Now,
+		rename:   os.Rename,
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	var rotateErr error
+	if r.shouldRotate(len(p)) {
+		// on failure, the current file is kept so the log is not lost
+		rotateErr = r.rotate()
+		if r.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil && rotateErr != nil {
+		err = fmt.Errorf("failed to rotate log file: %v", rotateErr)
+	}
+
+	return n, err
+}
+
+// Reopen closes and opens the file again, for external rotation tools such as logrotate
+// which rename the file before sending a SIGHUP. The current file is kept when the file
+// cannot be opened, and its age is kept when the same file is opened again.
+func (r *rotatingFile) Reopen() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	f, info, err := r.openFile()
+	if err != nil {
+		return err
+	}
+
+	openedAt := r.openedAtOf(info)
+	if current, err := r.file.Stat(); err == nil && os.SameFile(current, info) {
+		openedAt = r.openedAt
+	}
+	r.file.Close()
+
+	r.file = f
+	r.size = info.Size()
+	r.openedAt = openedAt
+
+	return nil
+}
+
+// Close closes the file, after waiting for the pending compressions
+func (r *rotatingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.background.Wait()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+func (r *rotatingFile) open() error {
+	f, info, err := r.openFile()
+	if err != nil {
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.openedAt = r.openedAtOf(info)
+
+	return nil
+}
+
+// openedAtOf returns the time the age of the opened file is computed from: its last modification
+// when it already holds logs, so restarts do not postpone the age rotation, or now otherwise.
+func (r *rotatingFile) openedAtOf(info os.FileInfo) time.Time {
+	if info.Size() > 0 {
+		return info.ModTime()
+	}
+
+	return r.now()
+}
+
+func (r *rotatingFile) openFile() (*os.File, os.FileInfo, error) {
+	f, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, LogFileMode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open log file: %v", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+func (r *rotatingFile) shouldRotate(writeSize int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.maxSize > 0 && r.size+int64(writeSize) > r.opts.maxSize {
+		return true
+	}
+
+	return r.opts.maxAge > 0 && r.now().Sub(r.openedAt) >= r.opts.maxAge
+}
+
+// rotate renames the current file and opens a new one, expected to be called with the lock held.
+// When the file cannot be renamed, the current file is opened again with its age, and file is only
+// left nil when no file can be opened.
+func (r *rotatingFile) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+
+	if err == nil {
+		err = r.rename(r.filename, r.rotatedName(r.now()))
+	}
+	if err != nil {
+		openedAt := r.openedAt
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+		r.openedAt = openedAt
+
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.background.Add(1)
+	go func() {
+		defer r.background.Done()
+		r.cleanup()
+	}()
+
+	return nil
+}
+
+// rotatedName returns the name of the file rotated at now. A counter is appended when a file, compressed
+// or not, was already rotated in the same millisecond, so it is not overwritten.
+func (r *rotatingFile) rotatedName(now time.Time) string {
+	base := r.filename + "." + now.Format(rotatedTimeFormat)
+
+	name := base
+	for i := 1; fileExists(name) || fileExists(name+compressedSuffix); i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	return name
+}
+
+// cleanup compresses the rotated files when enabled, and removes the oldest ones above maxFiles.
+// Errors are ignored, as there is no way to report them but the log itself.
+func (r *rotatingFile) cleanup() {
+	r.cleanupLock.Lock()
+	defer r.cleanupLock.Unlock()
+
+	rotated := r.rotatedFiles()
+
+	if r.opts.compress {
+		for i, file := range rotated {
+			if strings.HasSuffix(file, compressedSuffix) {
+				continue
+			}
+			if err := compressFile(file); err == nil {
+				rotated[i] = file + compressedSuffix
+			}
+		}
+	}
+
+	if r.opts.maxFiles > 0 && len(rotated) > r.opts.maxFiles {
+		for _, file := range rotated[:len(rotated)-r.opts.maxFiles] {
+			os.Remove(file)
+		}
+	}
+}
+
+// rotatedFiles returns the rotated files, oldest first
+func (r *rotatingFile) rotatedFiles() []string {
+	dir := filepath.Dir(r.filename)
+	prefix := filepath.Base(r.filename) + "."
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	type rotatedFile struct {
+		path      string
+		timestamp string
+		counter   int
+	}
+
+	var rotated []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressedSuffix)
+		timestamp, counter, hasCounter := strings.Cut(suffix, "-")
+		if _, err := time.Parse(rotatedTimeFormat, timestamp); err != nil {
+			continue
+		}
+
+		file := rotatedFile{path: filepath.Join(dir, name), timestamp: timestamp}
+		if hasCounter {
+			if file.counter, err = strconv.Atoi(counter); err != nil || file.counter < 1 {
+				continue
+			}
+		}
+		rotated = append(rotated, file)
+	}
+
+	sort.Slice(rotated, func(i, j int) bool {
+		if rotated[i].timestamp != rotated[j].timestamp {
+			return rotated[i].timestamp < rotated[j].timestamp
+		}
+		return rotated[i].counter < rotated[j].counter
+	})
+
+	files := make([]string, len(rotated))
+	for i, file := range rotated {
+		files[i] = file.path
+	}
+
+	return files
+}
+
+// fileExists returns true when a file or directory exists at name
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// compressFile replaces file by its gzip compressed version
+func compressFile(file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(file+compressedSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, LogFileMode)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+
+	return os.Remove(file)
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	t.Run("size rotation keeps max files, compressed", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		f, err := newRotatingFile(filename, rotateOptions{maxSize: 10, maxFiles: 2, compress: true})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		now := time.Now()
+		f.now = func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}
+
+		for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+			if _, err := f.Write([]byte(line)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		content, _ := os.ReadFile(filename)
+		if string(content) != "line 4\n" {
+			t.Errorf("Expected current file to hold the last line, got %q", content)
+		}
+
+		rotated := f.rotatedFiles()
+		if len(rotated) != 2 {
+			t.Fatalf("Expected 2 rotated files, got %v", rotated)
+		}
+		for i, expected := range []string{"line 2\n", "line 3\n"} {
+			if !strings.HasSuffix(rotated[i], compressedSuffix) {
+				t.Errorf("Expected %s to be compressed", rotated[i])
+				continue
+			}
+
+			gz, err := os.Open(rotated[i])
+			if err != nil {
+				t.Fatalf("failed to open %s: %v", rotated[i], err)
+			}
+			r, err := gzip.NewReader(gz)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", rotated[i], err)
+			}
+			content, _ := io.ReadAll(r)
+			gz.Close()
+
+			if string(content) != expected {
+				t.Errorf("Expected %s to hold %q, got %q", rotated[i], expected, content)
+			}
+		}
+	})
+
+	t.Run("age rotation", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		now := time.Now()
+		f, err := newRotatingFile(filename, rotateOptions{maxAge: time.Hour})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer f.Close()
+		f.now = func() time.Time { return now }
+		f.openedAt = now
+
+		f.Write([]byte("first\n"))
+		now = now.Add(30 * time.Minute)
+		f.Write([]byte("second\n"))
+		// reopening the same file keeps its age
+		if err := f.Reopen(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if rotated := f.rotatedFiles(); len(rotated) != 0 {
+			t.Errorf("Expected no rotation yet, got %v", rotated)
+		}
+
+		now = now.Add(30 * time.Minute)
+		f.Write([]byte("third\n"))
+		if rotated := f.rotatedFiles(); len(rotated) != 1 {
+			t.Errorf("Expected a rotation, got %v", rotated)
+		}
+	})
+
+	t.Run("failed rotation keeps writing to the current file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		now := time.Now()
+		f, err := newRotatingFile(filename, rotateOptions{maxSize: 10})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer f.Close()
+		f.now = func() time.Time { return now }
+
+		f.rename = func(string, string) error {
+			return syscall.EACCES
+		}
+
+		f.Write([]byte("line 1\n"))
+		if n, err := f.Write([]byte("line 2\n")); err == nil || n != len("line 2\n") {
+			t.Errorf("Expected the line to be written with a rotation error, got %d, %v", n, err)
+		}
+
+		f.rename = os.Rename
+		rotated := filename + "." + now.Format(rotatedTimeFormat)
+		if _, err := f.Write([]byte("line 3\n")); err != nil {
+			t.Fatalf("Expected no error once the rotation succeeds, got %v", err)
+		}
+
+		content, _ := os.ReadFile(rotated)
+		if string(content) != "line 1\nline 2\n" {
+			t.Errorf("Expected rotated file to hold the lines written before the rotation, got %q", content)
+		}
+		content, _ = os.ReadFile(filename)
+		if string(content) != "line 3\n" {
+			t.Errorf("Expected current file to hold the last line, got %q", content)
+		}
+	})
+
+	t.Run("rotations in the same millisecond keep every file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		f, err := newRotatingFile(filename, rotateOptions{maxSize: 10})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer f.Close()
+		now := time.Now()
+		f.now = func() time.Time { return now }
+
+		for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+			if _, err := f.Write([]byte(line)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		rotated := f.rotatedFiles()
+		if len(rotated) != 2 {
+			t.Fatalf("Expected 2 rotated files, got %v", rotated)
+		}
+		for i, expected := range []string{"line 1\n", "line 2\n"} {
+			if content, _ := os.ReadFile(rotated[i]); string(content) != expected {
+				t.Errorf("Expected %s to hold %q, got %q", rotated[i], expected, content)
+			}
+		}
+	})
+
+	t.Run("age of an existing file is its modification time", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		if err := os.WriteFile(filename, []byte("previous run\n"), LogFileMode); err != nil {
+			t.Fatalf("failed to write %s: %v", filename, err)
+		}
+		modTime := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(filename, modTime, modTime); err != nil {
+			t.Fatalf("failed to change %s times: %v", filename, err)
+		}
+
+		f, err := newRotatingFile(filename, rotateOptions{maxAge: time.Hour})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer f.Close()
+
+		f.Write([]byte("first\n"))
+		if rotated := f.rotatedFiles(); len(rotated) != 1 {
+			t.Errorf("Expected the existing file to be rotated, got %v", rotated)
+		}
+	})
+
+	t.Run("reopen after external rotation", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		f, err := newRotatingFile(filename, rotateOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer f.Close()
+
+		f.Write([]byte("before\n"))
+		os.Rename(filename, filename+".1")
+		if err := f.Reopen(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		f.Write([]byte("after\n"))
+
+		content, _ := os.ReadFile(filename)
+		if string(content) != "after\n" {
+			t.Errorf("Expected reopened file to only hold the new line, got %q", content)
+		}
+	})
+}
+
+func TestLoggerReopensOnSIGHUP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not supported on windows")
+	}
+
+	filename := filepath.Join(t.TempDir(), "app.log")
+	logger, err := New(LoggerCfg{Level: "info", Format: FormatLogfmt, Output: filename}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("before")
+	os.Rename(filename, filename+".1")
+
+	process, _ := os.FindProcess(os.Getpid())
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("failed to send SIGHUP: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filename); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the log file to be reopened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	logger.Info("after")
+	content, _ := os.ReadFile(filename)
+	if !strings.Contains(string(content), "after") || strings.Contains(string(content), "before") {
+		t.Errorf("Unexpected reopened file content %q", content)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// samplingWindow is the period over which identical messages are counted
+const samplingWindow = time.Second
+
+// samplingHandler is a slog.Handler dropping repeated messages: in each window, the first initial
+// messages of a level and message are logged, then one every thereafter.
+type samplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+var _ slog.Handler = (*samplingHandler)(nil)
+
+// sampler holds the counters, shared by the handlers derived with WithAttrs and WithGroup
+type sampler struct {
+	initial    int
+	thereafter int
+	now        func() time.Time
+
+	lock        sync.Mutex
+	windowStart time.Time
+	counts      map[samplingKey]int
+}
+
+type samplingKey struct {
+	level   slog.Level
+	message string
+}
+
+func newSamplingHandler(next slog.Handler, initial, thereafter int) *samplingHandler {
+	return &samplingHandler{
+		next: next,
+		sampler: &sampler{
+			initial:    initial,
+			thereafter: thereafter,
+			now:        time.Now,
+			counts:     make(map[samplingKey]int),
+		},
+	}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.sampler.sample(r.Level, r.Message) {
+		return nil
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
+
+// sample returns true when the message must be logged
+func (s *sampler) sample(level slog.Level, message string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= samplingWindow {
+		s.windowStart = now
+		s.counts = make(map[samplingKey]int)
+	}
+
+	key := samplingKey{level: level, message: message}
+	s.counts[key]++
+	count := s.counts[key]
+
+	if count <= s.initial {
+		return true
+	}
+
+	return s.thereafter > 0 && (count-s.initial)%s.thereafter == 0
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+// InstrumentDB registers the connection pool metrics of db, opened from cfg with db.Open,
+// such as go_sql_open_connections or go_sql_wait_count_total, labelled with the database name.
+func InstrumentDB(registry *Registry, db *sql.DB, cfg config.DBCfg) error {
+	return registry.labelled.Register(collectors.NewDBStatsCollector(db, DBName(cfg)))
+}
+
+// DBName returns the db_name label of the database metrics: the postgres database name,
+// or the SQLite file name without extension.
+func DBName(cfg config.DBCfg) string {
+	if cfg.Type == config.DBTypeSQLite {
+		name := filepath.Base(cfg.File)
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	return cfg.Database
+}
@@ -0,0 +1,284 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics builds the Prometheus registry of the server applications, so every service
+// exposes its metrics with the same names and standard labels.
+//
+//	var metricsCfg metrics.MetricsCfg
+//	loader.Load(metricsCfg.ViperCfgFields())
+//
+//	registry, err := metrics.NewRegistry(metricsCfg, "c2", version)
+//	metrics.InstrumentDB(registry, sqlDB, dbCfg)
+//	registry.MustRegister(requestsCounter)
+//
+//	// served by the admin server, or by its own listener when an address is configured
+//	adminServer, err := admin.NewServer(adminCfg, registry.AdminOptions()...)
+//	manager.Register(registry.Component(manager))
+//
+// Every metric is labelled with the service, version and instance, except the Go runtime
+// and process metrics which are only labelled with the service and instance.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/teserakt-io/serverlib/admin"
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/lifecycle"
+)
+
+// List of the standard labels added to every metric
+const (
+	LabelService  = "service"
+	LabelVersion  = "version"
+	LabelInstance = "instance"
+)
+
+const (
+	// DefaultPath is the default path of the exposition endpoint
+	DefaultPath = "/metrics"
+	// DefaultComponentName is the name of the metrics server lifecycle.Component
+	DefaultComponentName = "metrics"
+)
+
+// readHeaderTimeout protects the metrics server against slow clients
+const readHeaderTimeout = 10 * time.Second
+
+var namespaceRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetricsCfg holds the metrics configuration
+type MetricsCfg struct {
+	// Enabled exposes the metrics when true
+	Enabled bool
+	// Path is the path of the exposition endpoint
+	Path string
+	// Addr is the host:port of a dedicated metrics listener, without authentication.
+	// When empty, the metrics are served by the admin server.
+	Addr string
+	// Namespace prefixes the application metric names, such as c2 for c2_requests_total
+	Namespace string
+	// Instance is the value of the instance label, the hostname when empty
+	Instance string
+}
+
+// ViperCfgFields returns the list of configuration fields needed to load a MetricsCfg
+func (c *MetricsCfg) ViperCfgFields() []config.ViperCfgField {
+	return []config.ViperCfgField{
+		{Target: &c.Enabled, KeyName: "metrics-enabled", CfgType: config.ViperBool, DefaultValue: true},
+		{Target: &c.Path, KeyName: "metrics-path", CfgType: config.ViperString, DefaultValue: DefaultPath},
+		{Target: &c.Addr, KeyName: "metrics-addr", CfgType: config.ViperString, DefaultValue: ""},
+		{Target: &c.Namespace, KeyName: "metrics-namespace", CfgType: config.ViperString, DefaultValue: ""},
+		{Target: &c.Instance, KeyName: "metrics-instance", CfgType: config.ViperString, DefaultValue: "", EnvMapping: "METRICS_INSTANCE"},
+	}
+}
+
+// Validate checks the configuration is usable
+func (c MetricsCfg) Validate() error {
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("metrics path %q must start with /", c.Path)
+	}
+	// the admin server would panic registering the metrics on one of its own endpoints
+	for _, adminPath := range []string{admin.HealthzPath, admin.ReadyzPath, admin.VersionPath, admin.ConfigPath} {
+		if c.Path == adminPath {
+			return fmt.Errorf("metrics path %q is an admin server endpoint", c.Path)
+		}
+	}
+	if strings.HasPrefix(c.Path, strings.TrimSuffix(admin.PprofPath, "/")) {
+		return fmt.Errorf("metrics path %q is reserved to the admin server pprof endpoints", c.Path)
+	}
+	if c.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+			return errors.New("metrics address must be a host:port")
+		}
+	}
+	if c.Namespace != "" && !namespaceRegexp.MatchString(c.Namespace) {
+		return fmt.Errorf("invalid metrics namespace %q", c.Namespace)
+	}
+
+	return nil
+}
+
+// RegistryOption defines functions able to alter a Registry
+type RegistryOption func(*Registry)
+
+// WithLogger overrides the default slog logger
+func WithLogger(logger *slog.Logger) RegistryOption {
+	return func(r *Registry) {
+		r.logger = logger
+	}
+}
+
+// Registry holds the metrics of a service, labelled with the standard labels.
+// It embeds the prometheus.Registerer to register the application metrics, prefixed by the namespace.
+type Registry struct {
+	prometheus.Registerer
+
+	cfg      MetricsCfg
+	registry *prometheus.Registry
+	// labelled registers metrics with the standard labels, without namespace
+	labelled prometheus.Registerer
+	logger   *slog.Logger
+
+	lock       sync.Mutex
+	httpServer *http.Server
+}
+
+// NewRegistry validates cfg and creates a new Registry of the service, collecting the process and Go runtime metrics.
+// When cfg.Instance is empty, the instance label is the hostname.
+func NewRegistry(cfg MetricsCfg, service, version string, opts ...RegistryOption) (*Registry, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	instance := cfg.Instance
+	if instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metrics instance from hostname: %v", err)
+		}
+		instance = hostname
+	}
+
+	r := &Registry{
+		cfg:      cfg,
+		registry: prometheus.NewRegistry(),
+		logger:   slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.labelled = prometheus.WrapRegistererWith(prometheus.Labels{
+		LabelService:  service,
+		LabelVersion:  version,
+		LabelInstance: instance,
+	}, r.registry)
+
+	r.Registerer = r.labelled
+	if cfg.Namespace != "" {
+		r.Registerer = prometheus.WrapRegistererWithPrefix(cfg.Namespace+"_", r.labelled)
+	}
+
+	// the go_info metric already holds the Go version in its version label
+	runtimeRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{
+		LabelService:  service,
+		LabelInstance: instance,
+	}, r.registry)
+	if err := runtimeRegisterer.Register(collectors.NewGoCollector()); err != nil {
+		return nil, err
+	}
+	if err := runtimeRegisterer.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Gatherer returns the gatherer of all the registered metrics
+func (r *Registry) Gatherer() prometheus.Gatherer {
+	return r.registry
+}
+
+// Handler returns the exposition handler of the metrics
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(r.logger.Handler(), slog.LevelError),
+		Registry: r.labelled,
+	})
+}
+
+// AdminOptions returns the admin server options serving the metrics on the configured path,
+// when they are enabled without a dedicated address.
+func (r *Registry) AdminOptions() []admin.ServerOption {
+	if !r.cfg.Enabled || r.cfg.Addr != "" {
+		return nil
+	}
+
+	return []admin.ServerOption{admin.WithHandler(r.cfg.Path, r.Handler())}
+}
+
+// Component returns the lifecycle component of the dedicated metrics listener, reporting serving errors
+// to manager. It does nothing when the metrics are disabled or served by the admin server.
+func (r *Registry) Component(manager lifecycle.Manager) lifecycle.Component {
+	return lifecycle.Component{
+		Name: DefaultComponentName,
+		Start: func(ctx context.Context) error {
+			return r.start(func(err error) {
+				manager.Fail(DefaultComponentName, err)
+			})
+		},
+		Stop: r.stop,
+	}
+}
+
+func (r *Registry) start(onError func(error)) error {
+	if !r.cfg.Enabled || r.cfg.Addr == "" {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	listener, err := net.Listen("tcp", r.cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(r.cfg.Path, r.Handler())
+	r.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(r.logger.Handler(), slog.LevelWarn),
+	}
+
+	httpServer := r.httpServer
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			r.logger.Error("metrics server failed", "error", err)
+			onError(err)
+		}
+	}()
+	r.logger.Info("metrics server listening", "addr", listener.Addr().String(), "path", r.cfg.Path)
+
+	return nil
+}
+
+func (r *Registry) stop(ctx context.Context) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.httpServer == nil {
+		return nil
+	}
+
+	err := r.httpServer.Shutdown(ctx)
+	r.httpServer = nil
+
+	return err
+}
@@ -0,0 +1,273 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/teserakt-io/serverlib/admin"
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/config/configtest"
+	"github.com/teserakt-io/serverlib/db"
+	"github.com/teserakt-io/serverlib/lifecycle"
+	"github.com/teserakt-io/serverlib/tlsconfig"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestRegistry(t *testing.T, cfg MetricsCfg) *Registry {
+	t.Helper()
+
+	if cfg.Path == "" {
+		cfg.Path = DefaultPath
+	}
+	registry, err := NewRegistry(cfg, "c2", "1.2.3", WithLogger(discardLogger))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	return registry
+}
+
+// gather returns the metric of the registry with the given name, failing when not found
+func gather(t *testing.T, registry *Registry, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+
+	families, err := registry.Gatherer().Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if expected, ok := labels[label.GetName()]; ok && expected != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric
+		}
+	}
+
+	t.Fatalf("metric %s%v not found", name, labels)
+	return nil
+}
+
+func TestMetricsCfg(t *testing.T) {
+	t.Run("fields are loaded with defaults", func(t *testing.T) {
+		var cfg MetricsCfg
+		fields := cfg.ViperCfgFields()
+		configtest.MustLoad(t, configtest.NewLoader(t, "yaml", "metrics-namespace: c2\n"), fields)
+
+		configtest.AssertFields(t, fields, map[string]interface{}{
+			"metrics-enabled":   true,
+			"metrics-path":      DefaultPath,
+			"metrics-addr":      "",
+			"metrics-namespace": "c2",
+		})
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("invalid configurations", func(t *testing.T) {
+		valid := MetricsCfg{Enabled: true, Path: DefaultPath}
+		for name, alter := range map[string]func(c *MetricsCfg){
+			"path":       func(c *MetricsCfg) { c.Path = "metrics" },
+			"admin path": func(c *MetricsCfg) { c.Path = admin.ReadyzPath },
+			"pprof path": func(c *MetricsCfg) { c.Path = admin.PprofPath + "metrics" },
+			"address":    func(c *MetricsCfg) { c.Addr = "9090" },
+			"namespace":  func(c *MetricsCfg) { c.Namespace = "e4-c2" },
+		} {
+			cfg := valid
+			alter(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Errorf("Expected an error on invalid %s", name)
+			}
+		}
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("metrics have the standard labels and namespace", func(t *testing.T) {
+		registry := newTestRegistry(t, MetricsCfg{Enabled: true, Namespace: "c2", Instance: "node-1"})
+
+		counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."})
+		registry.MustRegister(counter)
+		counter.Add(3)
+
+		standardLabels := map[string]string{LabelService: "c2", LabelVersion: "1.2.3", LabelInstance: "node-1"}
+		if metric := gather(t, registry, "c2_requests_total", standardLabels); metric.GetCounter().GetValue() != 3 {
+			t.Errorf("Expected counter to be 3, got %v", metric.GetCounter().GetValue())
+		}
+		// runtime metrics keep their standard names
+		gather(t, registry, "go_goroutines", map[string]string{LabelService: "c2", LabelInstance: "node-1"})
+
+		rec := httptest.NewRecorder()
+		registry.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultPath, nil))
+		if !strings.Contains(rec.Body.String(), `c2_requests_total{instance="node-1",service="c2",version="1.2.3"} 3`) {
+			t.Errorf("Unexpected exposition:\n%s", rec.Body.String())
+		}
+	})
+
+	t.Run("served by the admin server", func(t *testing.T) {
+		registry := newTestRegistry(t, MetricsCfg{Enabled: true})
+		server, err := admin.NewServer(admin.ServerCfg{Addr: admin.DefaultAddr, Insecure: true}, registry.AdminOptions()...)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultPath, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "go_goroutines") {
+			t.Errorf("Expected metrics from the admin server, got %d", rec.Code)
+		}
+
+		if options := newTestRegistry(t, MetricsCfg{Enabled: true, Addr: "127.0.0.1:0"}).AdminOptions(); len(options) != 0 {
+			t.Error("Expected no admin options with a dedicated address")
+		}
+		if options := newTestRegistry(t, MetricsCfg{}).AdminOptions(); len(options) != 0 {
+			t.Error("Expected no admin options when disabled")
+		}
+	})
+
+	t.Run("dedicated listener", func(t *testing.T) {
+		registry := newTestRegistry(t, MetricsCfg{Enabled: true, Addr: "127.0.0.1:0"})
+		component := registry.Component(lifecycle.NewManager())
+		if err := component.Start(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer component.Stop(context.Background())
+
+		registry.lock.Lock()
+		if registry.httpServer == nil {
+			t.Error("Expected the metrics server to be started")
+		}
+		registry.lock.Unlock()
+
+		if err := component.Stop(context.Background()); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+}
+
+func TestInstrumentDB(t *testing.T) {
+	cfg := config.DBCfg{
+		Type: config.DBTypeSQLite,
+		File: filepath.Join(t.TempDir(), "e4.sqlite"),
+		SQLite: config.SQLiteCfg{
+			JournalMode: config.SQLiteJournalModeWAL,
+			Synchronous: config.SQLiteSynchronousNormal,
+		},
+	}
+	sqlDB, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer sqlDB.Close()
+
+	registry := newTestRegistry(t, MetricsCfg{Enabled: true})
+	if err := InstrumentDB(registry, sqlDB, cfg); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := InstrumentDB(registry, sqlDB, cfg); err == nil {
+		t.Error("Expected an error when instrumenting the same database twice")
+	}
+
+	if err := sqlDB.Ping(); err != nil {
+		t.Fatalf("failed to ping database: %v", err)
+	}
+	if metric := gather(t, registry, "go_sql_open_connections", map[string]string{"db_name": "e4"}); metric.GetGauge().GetValue() != 1 {
+		t.Errorf("Expected 1 open connection, got %v", metric.GetGauge().GetValue())
+	}
+
+	if name := DBName(config.DBCfg{Type: config.DBTypePostgres, Database: "c2"}); name != "c2" {
+		t.Errorf("Expected postgres db name to be c2, got %s", name)
+	}
+}
+
+func TestInstrumentCertificateExpiry(t *testing.T) {
+	report, err := tlsconfig.GenerateDevCerts(configtest.NewTempResolver(t, nil), tlsconfig.WithDevCertValidity(48*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to generate certificates: %v", err)
+	}
+	monitor := tlsconfig.NewExpiryMonitor([]string{report.ServerCert.Path}, tlsconfig.WithExpiryLogger(discardLogger))
+	if err := monitor.Check(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	registry := newTestRegistry(t, MetricsCfg{Enabled: true, Namespace: "c2"})
+	if err := InstrumentCertificateExpiry(registry, monitor); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	metric := gather(t, registry, "tls_certificate_expiry_seconds", map[string]string{"file": report.ServerCert.Path, "index": "0"})
+	if value := metric.GetGauge().GetValue(); value <= (47*time.Hour).Seconds() || value > (48*time.Hour).Seconds() {
+		t.Errorf("Expected about 48 hours left, got %v seconds", value)
+	}
+}
+
+func TestReloadMetrics(t *testing.T) {
+	registry := newTestRegistry(t, MetricsCfg{Enabled: true, Namespace: "c2"})
+	m, err := NewReloadMetrics(registry)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	now := time.Unix(1600000000, 0)
+	m.now = func() time.Time { return now }
+
+	errReload := errors.New("invalid configuration")
+	hook := m.Instrument(func(context.Context) error { return nil })
+	failingHook := m.Instrument(func(context.Context) error { return errReload })
+
+	hook(context.Background())
+	now = now.Add(time.Minute)
+	if err := failingHook(context.Background()); err != errReload {
+		t.Errorf("Expected the hook error, got %v", err)
+	}
+
+	for name, expected := range map[string]float64{
+		"c2_config_last_reload_timestamp_seconds":         float64(now.Unix()),
+		"c2_config_last_reload_success_timestamp_seconds": float64(now.Add(-time.Minute).Unix()),
+		"c2_config_last_reload_successful":                0,
+	} {
+		if value := gather(t, registry, name, nil).GetGauge().GetValue(); value != expected {
+			t.Errorf("Expected %s to be %v, got %v", name, expected, value)
+		}
+	}
+	for result, expected := range map[string]float64{ReloadResultSuccess: 1, ReloadResultFailure: 1} {
+		metric := gather(t, registry, "c2_config_reloads_total", map[string]string{"result": result})
+		if value := metric.GetCounter().GetValue(); value != expected {
+			t.Errorf("Expected %s reloads to be %v, got %v", result, expected, value)
+		}
+	}
+}
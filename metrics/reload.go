@@ -0,0 +1,106 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/teserakt-io/serverlib/lifecycle"
+)
+
+// List of the values of the result label of the config_reloads_total metric
+const (
+	ReloadResultSuccess = "success"
+	ReloadResultFailure = "failure"
+)
+
+// ReloadMetrics counts the configuration reloads
+type ReloadMetrics struct {
+	reloads        *prometheus.CounterVec
+	lastReload     prometheus.Gauge
+	lastSuccess    prometheus.Gauge
+	lastSuccessful prometheus.Gauge
+	now            func() time.Time
+}
+
+// NewReloadMetrics registers the configuration reload metrics, prefixed by the registry namespace:
+//   - config_reloads_total, by result
+//   - config_last_reload_timestamp_seconds, the time of the last reload
+//   - config_last_reload_success_timestamp_seconds, the time of the last successful reload
+//   - config_last_reload_successful, 1 when the last reload succeeded, 0 otherwise
+func NewReloadMetrics(registry *Registry) (*ReloadMetrics, error) {
+	m := &ReloadMetrics{
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "config_reloads_total",
+			Help: "Number of configuration reloads, by result.",
+		}, []string{"result"}),
+		lastReload: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "config_last_reload_timestamp_seconds",
+			Help: "Time of the last configuration reload.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "config_last_reload_success_timestamp_seconds",
+			Help: "Time of the last successful configuration reload.",
+		}),
+		lastSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "config_last_reload_successful",
+			Help: "Whether the last configuration reload succeeded.",
+		}),
+		now: time.Now,
+	}
+
+	// both results are exposed from the start, so their rate can be computed on the first reload
+	m.reloads.WithLabelValues(ReloadResultSuccess)
+	m.reloads.WithLabelValues(ReloadResultFailure)
+	// the configuration loaded on startup counts as a successful reload
+	m.lastSuccessful.Set(1)
+
+	for _, collector := range []prometheus.Collector{m.reloads, m.lastReload, m.lastSuccess, m.lastSuccessful} {
+		if err := registry.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Observe records a reload, failed when err is not nil
+func (m *ReloadMetrics) Observe(err error) {
+	now := float64(m.now().UnixNano()) / float64(time.Second)
+	m.lastReload.Set(now)
+
+	if err != nil {
+		m.reloads.WithLabelValues(ReloadResultFailure).Inc()
+		m.lastSuccessful.Set(0)
+		return
+	}
+
+	m.reloads.WithLabelValues(ReloadResultSuccess).Inc()
+	m.lastSuccess.Set(now)
+	m.lastSuccessful.Set(1)
+}
+
+// Instrument returns a lifecycle.Hook observing every call of the reload hook
+func (m *ReloadMetrics) Instrument(hook lifecycle.Hook) lifecycle.Hook {
+	return func(ctx context.Context) error {
+		err := hook(ctx)
+		m.Observe(err)
+
+		return err
+	}
+}
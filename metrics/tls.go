@@ -0,0 +1,65 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/teserakt-io/serverlib/tlsconfig"
+)
+
+// InstrumentCertificateExpiry registers the tls_certificate_expiry_seconds metric, holding the seconds
+// left before the expiry of every certificate found by the last check of monitor, negative once expired.
+// It is labelled with the certificate file, index in the file and subject.
+func InstrumentCertificateExpiry(registry *Registry, monitor tlsconfig.ExpiryMonitor) error {
+	return registry.labelled.Register(&certificateExpiryCollector{
+		monitor: monitor,
+		desc: prometheus.NewDesc(
+			"tls_certificate_expiry_seconds",
+			"Seconds left before the certificate expiry, negative once expired.",
+			[]string{"file", "index", "subject"},
+			nil,
+		),
+		now: time.Now,
+	})
+}
+
+// certificateExpiryCollector collects the expiries of an ExpiryMonitor
+type certificateExpiryCollector struct {
+	monitor tlsconfig.ExpiryMonitor
+	desc    *prometheus.Desc
+	now     func() time.Time
+}
+
+var _ prometheus.Collector = (*certificateExpiryCollector)(nil)
+
+func (c *certificateExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *certificateExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	now := c.now()
+	for _, expiry := range c.monitor.Expiries() {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc,
+			prometheus.GaugeValue,
+			expiry.NotAfter.Sub(now).Seconds(),
+			expiry.File, strconv.Itoa(expiry.Index), expiry.Subject,
+		)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TemplateSuffix is the suffix of the configuration templates found in the share directory.
+// A share/e4/projectconf.yaml.template file is copied to configs/projectconf.yaml by Bootstrap.
+var TemplateSuffix = ".template"
+
+const (
+	// DefaultDirMode is the mode of the directories created by Bootstrap
+	DefaultDirMode os.FileMode = 0750
+	// DefaultConfigFileMode is the mode of the configuration files copied from templates by Bootstrap
+	DefaultConfigFileMode os.FileMode = 0600
+)
+
+// DirReport holds the verification result of a layout directory
+type DirReport struct {
+	// Name identifies the directory in the layout, such as "config" or "log"
+	Name string
+	Path string
+	// Exists is true when the directory exists after the bootstrap
+	Exists bool
+	// Created is true when the directory has been created by the bootstrap
+	Created bool
+	Mode    os.FileMode
+	// Owned is true when the directory belongs to the current user
+	Owned bool
+	// Writable is true when a file could be created in the directory.
+	// In verify only mode, it is true when the current user is granted write access.
+	Writable bool
+	// Problems lists every issue found on the directory
+	Problems []string
+}
+
+// TemplateReport holds the result of a template copy
+type TemplateReport struct {
+	Source      string
+	Destination string
+	// Copied is true when the destination has been created from the template
+	Copied bool
+	// Problem is the error encountered while copying, if any
+	Problem string
+}
+
+// BootstrapReport holds the result of a layout bootstrap or verification
+type BootstrapReport struct {
+	Dirs      []DirReport
+	Templates []TemplateReport
+}
+
+// OK returns true when no problem has been found
+func (r *BootstrapReport) OK() bool {
+	for _, dir := range r.Dirs {
+		if len(dir.Problems) > 0 {
+			return false
+		}
+	}
+	for _, template := range r.Templates {
+		if template.Problem != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns a human readable report, suitable for a doctor command output
+func (r *BootstrapReport) String() string {
+	var b strings.Builder
+	for _, dir := range r.Dirs {
+		status := "ok"
+		if len(dir.Problems) > 0 {
+			status = strings.Join(dir.Problems, ", ")
+		}
+		fmt.Fprintf(&b, "%-7s %s (%v): %s\n", dir.Name, dir.Path, dir.Mode, status)
+	}
+	for _, template := range r.Templates {
+		switch {
+		case template.Problem != "":
+			fmt.Fprintf(&b, "template %s: %s\n", template.Destination, template.Problem)
+		case template.Copied:
+			fmt.Fprintf(&b, "template %s: created from %s\n", template.Destination, template.Source)
+		}
+	}
+
+	return b.String()
+}
+
+// BootstrapOption defines functions able to alter the bootstrap behavior
+type BootstrapOption func(*bootstrapOptions)
+
+type bootstrapOptions struct {
+	verifyOnly bool
+	dirMode    os.FileMode
+}
+
+// WithVerifyOnly only verifies the layout, without creating or removing anything
+func WithVerifyOnly() BootstrapOption {
+	return func(o *bootstrapOptions) {
+		o.verifyOnly = true
+	}
+}
+
+// WithDirMode overrides the DefaultDirMode
+func WithDirMode(mode os.FileMode) BootstrapOption {
+	return func(o *bootstrapOptions) {
+		o.dirMode = mode
+	}
+}
+
+// Bootstrap creates the missing directories of the layout, copies the templates found in the share directory
+// into the configuration directory when absent, and verifies every directory.
+// The share directory is provided by the installation, it is never created and may be missing.
+// The returned error is only set when the bootstrap could not run, problems are reported in the BootstrapReport.
+func Bootstrap(resolver *LayoutResolver, opts ...BootstrapOption) (*BootstrapReport, error) {
+	o := &bootstrapOptions{dirMode: DefaultDirMode}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	layout := resolver.Layout()
+	report := &BootstrapReport{}
+
+	for _, dir := range []struct {
+		name string
+		path string
+	}{
+		{name: "config", path: layout.Config},
+		{name: "data", path: layout.Data},
+		{name: "log", path: layout.Log},
+		{name: "run", path: layout.Run},
+		{name: "cache", path: layout.Cache},
+	} {
+		report.Dirs = append(report.Dirs, bootstrapDir(dir.name, dir.path, o))
+	}
+
+	share := DirReport{Name: "share", Path: layout.Share}
+	if info, err := os.Stat(layout.Share); err == nil && info.IsDir() {
+		share.Exists = true
+		share.Mode = info.Mode().Perm()
+		share.Owned = isOwnedByCurrentUser(info)
+
+		templates, err := copyTemplates(layout.Share, layout.Config, o.verifyOnly)
+		if err != nil {
+			return nil, err
+		}
+		report.Templates = templates
+	}
+	report.Dirs = append(report.Dirs, share)
+
+	return report, nil
+}
+
+func bootstrapDir(name, path string, o *bootstrapOptions) DirReport {
+	report := DirReport{Name: name, Path: path}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && !o.verifyOnly {
+		// explicit chmod, so the mode does not depend on the umask
+		if err = os.MkdirAll(path, o.dirMode); err == nil {
+			if err = os.Chmod(path, o.dirMode); err == nil {
+				report.Created = true
+				info, err = os.Stat(path)
+			}
+		}
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			report.Problems = append(report.Problems, "missing")
+		} else {
+			report.Problems = append(report.Problems, err.Error())
+		}
+		return report
+	}
+
+	if !info.IsDir() {
+		report.Problems = append(report.Problems, "not a directory")
+		return report
+	}
+
+	report.Exists = true
+	report.Mode = info.Mode().Perm()
+	report.Owned = isOwnedByCurrentUser(info)
+	if o.verifyOnly {
+		report.Writable = hasWriteAccess(path)
+	} else {
+		report.Writable = IsWritable(path)
+	}
+
+	if !report.Owned {
+		report.Problems = append(report.Problems, "not owned by current user")
+	}
+	if report.Mode&0002 != 0 {
+		report.Problems = append(report.Problems, "world writable")
+	}
+	if name == "config" && report.Mode&0007 != 0 {
+		report.Problems = append(report.Problems, "accessible by other users")
+	}
+	if !report.Writable {
+		report.Problems = append(report.Problems, "not writable")
+	}
+
+	return report
+}
+
+// IsWritable checks a file can be created in dir
+func IsWritable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".writable-")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	return true
+}
+
+// copyTemplates copies every template of shareDir missing from configDir
+func copyTemplates(shareDir, configDir string, verifyOnly bool) ([]TemplateReport, error) {
+	entries, err := os.ReadDir(shareDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []TemplateReport
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), TemplateSuffix) {
+			continue
+		}
+
+		report := TemplateReport{
+			Source:      filepath.Join(shareDir, entry.Name()),
+			Destination: filepath.Join(configDir, strings.TrimSuffix(entry.Name(), TemplateSuffix)),
+		}
+
+		if _, err := os.Stat(report.Destination); err == nil {
+			reports = append(reports, report)
+			continue
+		}
+
+		if verifyOnly {
+			report.Problem = "missing"
+		} else if err := copyFile(report.Source, report.Destination, DefaultConfigFileMode); err != nil {
+			report.Problem = err.Error()
+		} else {
+			report.Copied = true
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// O_EXCL so an existing configuration is never overwritten
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBootstrap(t *testing.T) {
+	newLayout := func(t *testing.T) (*LayoutResolver, string) {
+		prefix := t.TempDir()
+		binary, err := NewAppPathResolver(filepath.Join(prefix, "bin", "binary"))
+		if err != nil {
+			t.Fatalf("Failed to create AppPathResolver: %v", err)
+		}
+
+		return NewLayoutResolver("e4", binary, WithLayoutMode(LayoutBinaryRelative)), prefix
+	}
+
+	writeTemplate := func(t *testing.T, layout *LayoutResolver, name, content string) {
+		if err := os.MkdirAll(layout.ShareDir(), 0755); err != nil {
+			t.Fatalf("Failed to create share dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(layout.ShareDir(), name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+	}
+
+	t.Run("Bootstrap creates the layout and copies templates", func(t *testing.T) {
+		layout, _ := newLayout(t)
+		writeTemplate(t, layout, "projectconf.yaml.template", "key: value\n")
+		writeTemplate(t, layout, "README", "not a template")
+
+		report, err := Bootstrap(layout)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if !report.OK() {
+			t.Errorf("Expected report to be ok, got:\n%s", report)
+		}
+
+		for _, dir := range report.Dirs {
+			if dir.Name == "share" {
+				if dir.Created || !dir.Exists {
+					t.Errorf("Expected share dir to exist without being created, got %#v", dir)
+				}
+				continue
+			}
+
+			if !dir.Created || !dir.Exists || !dir.Writable || !dir.Owned {
+				t.Errorf("Expected %s dir to be created, writable and owned, got %#v", dir.Name, dir)
+			}
+			if dir.Mode != DefaultDirMode {
+				t.Errorf("Expected %s dir mode to be %v, got %v", dir.Name, DefaultDirMode, dir.Mode)
+			}
+		}
+
+		if len(report.Templates) != 1 || !report.Templates[0].Copied {
+			t.Fatalf("Expected a single copied template, got %#v", report.Templates)
+		}
+
+		configFile := layout.ConfigFile("projectconf.yaml")
+		content, err := os.ReadFile(configFile)
+		if err != nil {
+			t.Fatalf("Failed to read config file: %v", err)
+		}
+		if string(content) != "key: value\n" {
+			t.Errorf("Expected config file content to be copied from template, got %s", content)
+		}
+
+		info, err := os.Stat(configFile)
+		if err != nil {
+			t.Fatalf("Failed to stat config file: %v", err)
+		}
+		if info.Mode().Perm() != DefaultConfigFileMode {
+			t.Errorf("Expected config file mode to be %v, got %v", DefaultConfigFileMode, info.Mode().Perm())
+		}
+	})
+
+	t.Run("Bootstrap never overwrites existing configuration", func(t *testing.T) {
+		layout, _ := newLayout(t)
+		writeTemplate(t, layout, "projectconf.yaml.template", "key: value\n")
+
+		if _, err := Bootstrap(layout); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		configFile := layout.ConfigFile("projectconf.yaml")
+		if err := os.WriteFile(configFile, []byte("key: edited\n"), 0600); err != nil {
+			t.Fatalf("Failed to edit config file: %v", err)
+		}
+
+		report, err := Bootstrap(layout)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		for _, dir := range report.Dirs {
+			if dir.Created {
+				t.Errorf("Expected %s dir to not be created twice", dir.Name)
+			}
+		}
+		if report.Templates[0].Copied {
+			t.Errorf("Expected template to not be copied over existing configuration")
+		}
+
+		content, err := os.ReadFile(configFile)
+		if err != nil {
+			t.Fatalf("Failed to read config file: %v", err)
+		}
+		if string(content) != "key: edited\n" {
+			t.Errorf("Expected config file to be kept, got %s", content)
+		}
+	})
+
+	t.Run("Bootstrap only verifies in verify only mode", func(t *testing.T) {
+		layout, _ := newLayout(t)
+		writeTemplate(t, layout, "projectconf.yaml.template", "key: value\n")
+
+		report, err := Bootstrap(layout, WithVerifyOnly())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if report.OK() {
+			t.Errorf("Expected report to not be ok")
+		}
+		for _, dir := range report.Dirs {
+			if dir.Name != "share" && (dir.Exists || len(dir.Problems) != 1 || dir.Problems[0] != "missing") {
+				t.Errorf("Expected %s dir to be reported missing, got %#v", dir.Name, dir)
+			}
+		}
+		if report.Templates[0].Copied || report.Templates[0].Problem != "missing" {
+			t.Errorf("Expected template to be reported missing, got %#v", report.Templates[0])
+		}
+
+		if _, err := os.Stat(layout.ConfigDir()); !os.IsNotExist(err) {
+			t.Errorf("Expected config dir to not be created, got %v", err)
+		}
+	})
+
+	t.Run("Bootstrap does not modify an existing layout in verify only mode", func(t *testing.T) {
+		layout, _ := newLayout(t)
+		if _, err := Bootstrap(layout); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// creating or removing a file would update the modification time of the directory
+		past := time.Now().Add(-time.Hour).Truncate(time.Second)
+		if err := os.Chtimes(layout.DataDir(), past, past); err != nil {
+			t.Fatalf("Failed to set data dir times: %v", err)
+		}
+
+		report, err := Bootstrap(layout, WithVerifyOnly())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !report.OK() {
+			t.Errorf("Expected report to be ok, got:\n%s", report)
+		}
+		for _, dir := range report.Dirs {
+			if dir.Name != "share" && !dir.Writable {
+				t.Errorf("Expected %s dir to be writable, got %#v", dir.Name, dir)
+			}
+		}
+
+		info, err := os.Stat(layout.DataDir())
+		if err != nil {
+			t.Fatalf("Failed to stat data dir: %v", err)
+		}
+		if !info.ModTime().Equal(past) {
+			t.Errorf("Expected data dir to not be modified, got modification time %v", info.ModTime())
+		}
+	})
+
+	t.Run("Bootstrap reports insecure permissions", func(t *testing.T) {
+		layout, _ := newLayout(t)
+		if err := os.MkdirAll(layout.ConfigDir(), 0700); err != nil {
+			t.Fatalf("Failed to create config dir: %v", err)
+		}
+		if err := os.MkdirAll(layout.LogDir(), 0700); err != nil {
+			t.Fatalf("Failed to create log dir: %v", err)
+		}
+		// explicit chmod, as MkdirAll is subject to umask
+		if err := os.Chmod(layout.ConfigDir(), 0755); err != nil {
+			t.Fatalf("Failed to chmod config dir: %v", err)
+		}
+		if err := os.Chmod(layout.LogDir(), 0777); err != nil {
+			t.Fatalf("Failed to chmod log dir: %v", err)
+		}
+
+		report, err := Bootstrap(layout)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expectedProblems := map[string]string{
+			"config": "accessible by other users",
+			"log":    "world writable",
+		}
+		for _, dir := range report.Dirs {
+			expectedProblem, ok := expectedProblems[dir.Name]
+			if !ok {
+				if len(dir.Problems) > 0 {
+					t.Errorf("Expected no problems on %s dir, got %v", dir.Name, dir.Problems)
+				}
+				continue
+			}
+
+			if len(dir.Problems) != 1 || dir.Problems[0] != expectedProblem {
+				t.Errorf("Expected %s dir problems to be [%s], got %v", dir.Name, expectedProblem, dir.Problems)
+			}
+		}
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigPathResolver defines a ConfigDirResolver able to reject paths.
+// Configuration loaders should prefer ResolveConfigPath over ConfigRelativePath when available.
+type ConfigPathResolver interface {
+	ConfigDirResolver
+	ResolveConfigPath(relPath string) (string, error)
+}
+
+// PathEscapeError is returned when a configured path resolves outside of the allowed directories
+type PathEscapeError struct {
+	// Path is the path as written in the configuration
+	Path string
+	// Resolved is the absolute path, after symlinks evaluation
+	Resolved string
+	// ConfigDir is the directory the path should have been confined to
+	ConfigDir string
+}
+
+func (e *PathEscapeError) Error() string {
+	return fmt.Sprintf("path %q resolves to %s, outside of the configuration directory %s", e.Path, e.Resolved, e.ConfigDir)
+}
+
+// ConfinedResolver is a ConfigDirResolver rejecting any path escaping the configuration directory,
+// or an explicitly allowed root for absolute paths. Symlinks are evaluated before the check.
+type ConfinedResolver struct {
+	parent       ConfigDirResolver
+	allowedRoots []string
+}
+
+var _ ConfigPathResolver = (*ConfinedResolver)(nil)
+
+// NewConfinedResolver returns a new ConfinedResolver, confining the paths of parent to its configuration
+// directory. Absolute paths are also accepted when located in one of the allowedRoots.
+func NewConfinedResolver(parent ConfigDirResolver, allowedRoots ...string) *ConfinedResolver {
+	return &ConfinedResolver{
+		parent:       parent,
+		allowedRoots: allowedRoots,
+	}
+}
+
+// ConfigDir returns the configuration directory of the parent resolver
+func (c *ConfinedResolver) ConfigDir() string {
+	return c.parent.ConfigDir()
+}
+
+// ConfigRelativePath resolves relPath like the parent resolver, but returns an empty string
+// when the path is rejected. Use ResolveConfigPath to get the rejection reason.
+func (c *ConfinedResolver) ConfigRelativePath(relPath string) string {
+	path, err := c.ResolveConfigPath(relPath)
+	if err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// ResolveConfigPath resolves relPath like the parent resolver, returning a *PathEscapeError
+// when the result, after symlinks evaluation, is outside of the configuration directory and allowed roots.
+func (c *ConfinedResolver) ResolveConfigPath(relPath string) (string, error) {
+	path, err := ResolveConfigPath(c.parent, relPath)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := evalSymlinksPartial(path)
+	if err != nil {
+		return "", err
+	}
+
+	roots := []string{c.ConfigDir()}
+	if filepath.IsAbs(relPath) {
+		roots = append(roots, c.allowedRoots...)
+	}
+
+	for _, root := range roots {
+		resolvedRoot, err := evalSymlinksPartial(root)
+		if err != nil {
+			return "", err
+		}
+
+		if isWithin(resolvedRoot, resolved) {
+			return path, nil
+		}
+	}
+
+	return "", &PathEscapeError{Path: relPath, Resolved: resolved, ConfigDir: c.ConfigDir()}
+}
+
+// evalSymlinksPartial returns the absolute path with symlinks evaluated on its longest existing prefix,
+// so paths of files yet to be created can be checked too.
+func evalSymlinksPartial(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, missing...)...), nil
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// isWithin returns true when path is root or one of its descendants
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfinedResolver(t *testing.T) {
+	// EvalSymlinks so the expectations hold when the temp dir is itself behind a symlink
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve temp dir: %v", err)
+	}
+
+	appResolver, err := NewAppPathResolver(filepath.Join(root, "bin", "binary"))
+	if err != nil {
+		t.Fatalf("Failed to create AppPathResolver: %v", err)
+	}
+	configDir := appResolver.ConfigDir()
+	outsideDir := filepath.Join(root, "outside")
+	allowedDir := filepath.Join(root, "certs")
+
+	for _, dir := range []string{configDir, outsideDir, allowedDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.Symlink(outsideDir, filepath.Join(configDir, "escape")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(configDir, "escape"), filepath.Join(allowedDir, "escape")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	resolver := NewConfinedResolver(appResolver, allowedDir)
+
+	if resolver.ConfigDir() != configDir {
+		t.Errorf("Expected config dir to be %s, got %s", configDir, resolver.ConfigDir())
+	}
+
+	t.Run("ResolveConfigPath accepts paths inside the config dir", func(t *testing.T) {
+		testCases := map[string]string{
+			"cert.pem":                          filepath.Join(configDir, "cert.pem"),
+			"./sub/../not/created.pem":          filepath.Join(configDir, "not", "created.pem"),
+			"":                                  configDir,
+			filepath.Join(configDir, "abs.pem"): filepath.Join(configDir, "abs.pem"),
+			filepath.Join(allowedDir, "ca.pem"): filepath.Join(allowedDir, "ca.pem"),
+		}
+
+		for relPath, expectedPath := range testCases {
+			path, err := resolver.ResolveConfigPath(relPath)
+			if err != nil {
+				t.Errorf("Expected no error for path %s, got %v", relPath, err)
+			}
+
+			if path != expectedPath {
+				t.Errorf("Expected path to be %s, got %s", expectedPath, path)
+			}
+
+			if path := resolver.ConfigRelativePath(relPath); path != expectedPath {
+				t.Errorf("Expected path to be %s, got %s", expectedPath, path)
+			}
+		}
+	})
+
+	t.Run("ResolveConfigPath rejects paths escaping the config dir", func(t *testing.T) {
+		testCases := []string{
+			"../../etc/shadow",
+			"../outside/file",
+			"escape/file",
+			"escape/not/created/file",
+			"/etc/shadow",
+			filepath.Join(allowedDir, "..", "outside"),
+			filepath.Join(allowedDir, "escape", "file"),
+		}
+
+		for _, relPath := range testCases {
+			_, err := resolver.ResolveConfigPath(relPath)
+
+			var escapeErr *PathEscapeError
+			if !errors.As(err, &escapeErr) {
+				t.Errorf("Expected a PathEscapeError for path %s, got %v", relPath, err)
+				continue
+			}
+			if escapeErr.Path != relPath || escapeErr.ConfigDir != configDir {
+				t.Errorf("Expected error to reference path %s and config dir %s, got %#v", relPath, configDir, escapeErr)
+			}
+
+			if path := resolver.ConfigRelativePath(relPath); path != "" {
+				t.Errorf("Expected rejected path to be empty, got %s", path)
+			}
+		}
+	})
+
+	t.Run("Allowed roots do not apply to relative paths", func(t *testing.T) {
+		if _, err := resolver.ResolveConfigPath("../certs/ca.pem"); err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+	})
+}
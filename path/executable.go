@@ -0,0 +1,105 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ExecutableOption defines functions able to alter the executable location resolution
+type ExecutableOption func(*executableOptions)
+
+type executableOptions struct {
+	followSymlinks bool
+}
+
+// WithFollowSymlinks sets whether a symlink to the executable is resolved to its target, which is the default.
+// Following symlinks allows installing a link in /usr/local/bin while keeping the configs next to the real binary.
+func WithFollowSymlinks(follow bool) ExecutableOption {
+	return func(o *executableOptions) {
+		o.followSymlinks = follow
+	}
+}
+
+func newExecutableOptions(opts []ExecutableOption) *executableOptions {
+	o := &executableOptions{followSymlinks: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// NewExecutableAppPathResolver returns a new AppPathResolver from the location of the running executable.
+// When following symlinks, the location is obtained from os.Executable, otherwise
+// os.Args[0] is resolved with ResolveExecutable, as os.Executable may already have resolved symlinks on some platforms.
+func NewExecutableAppPathResolver(opts ...ExecutableOption) (*AppPathResolver, error) {
+	o := newExecutableOptions(opts)
+
+	if !o.followSymlinks {
+		binaryPath, err := ResolveExecutable(os.Args[0], opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewAppPathResolver(binaryPath)
+	}
+
+	binaryPath, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	binaryPath, err = filepath.EvalSymlinks(binaryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAppPathResolver(binaryPath)
+}
+
+// ResolveExecutable returns the absolute location of an executable invoked as argv0.
+// When argv0 holds no path separator, the executable is looked up in $PATH like the shell would,
+// otherwise it is resolved from the current working directory.
+func ResolveExecutable(argv0 string, opts ...ExecutableOption) (string, error) {
+	o := newExecutableOptions(opts)
+
+	binaryPath := argv0
+	if !strings.ContainsRune(argv0, filepath.Separator) {
+		lookedUp, err := exec.LookPath(argv0)
+		if err != nil {
+			return "", err
+		}
+		binaryPath = lookedUp
+	}
+
+	binaryPath, err := filepath.Abs(binaryPath)
+	if err != nil {
+		return "", err
+	}
+
+	if o.followSymlinks {
+		return filepath.EvalSymlinks(binaryPath)
+	}
+
+	if _, err := os.Stat(binaryPath); err != nil {
+		return "", err
+	}
+
+	return binaryPath, nil
+}
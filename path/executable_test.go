@@ -0,0 +1,161 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupInstall creates an /opt/e4/bin/binary executable in a temporary prefix,
+// symlinked from /usr/local/bin/binary
+func setupInstall(t *testing.T) (prefix string, binaryPath string, linkPath string) {
+	// EvalSymlinks so the expectations hold when the temp dir is itself behind a symlink
+	prefix, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve temp dir: %v", err)
+	}
+
+	binaryPath = filepath.Join(prefix, "opt", "e4", "bin", "binary")
+	linkPath = filepath.Join(prefix, "usr", "local", "bin", "binary")
+
+	for _, dir := range []string{filepath.Dir(binaryPath), filepath.Dir(linkPath)} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+
+	if err := os.WriteFile(binaryPath, []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatalf("Failed to write binary: %v", err)
+	}
+
+	if err := os.Symlink(binaryPath, linkPath); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	return prefix, binaryPath, linkPath
+}
+
+func TestResolveExecutable(t *testing.T) {
+	t.Run("ResolveExecutable looks up $PATH", func(t *testing.T) {
+		_, binaryPath, _ := setupInstall(t)
+		t.Setenv("PATH", filepath.Dir(binaryPath))
+
+		path, err := ResolveExecutable("binary")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if path != binaryPath {
+			t.Errorf("Expected path to be %s, got %s", binaryPath, path)
+		}
+	})
+
+	t.Run("ResolveExecutable resolves relative invocations", func(t *testing.T) {
+		_, binaryPath, _ := setupInstall(t)
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("Failed to get working directory: %v", err)
+		}
+		relPath, err := filepath.Rel(cwd, binaryPath)
+		if err != nil {
+			t.Fatalf("Failed to compute relative path: %v", err)
+		}
+
+		path, err := ResolveExecutable(relPath)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if path != binaryPath {
+			t.Errorf("Expected path to be %s, got %s", binaryPath, path)
+		}
+	})
+
+	t.Run("ResolveExecutable follows symlinked installs", func(t *testing.T) {
+		prefix, binaryPath, linkPath := setupInstall(t)
+		t.Setenv("PATH", filepath.Dir(linkPath))
+
+		path, err := ResolveExecutable("binary")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if path != binaryPath {
+			t.Errorf("Expected path to be %s, got %s", binaryPath, path)
+		}
+
+		resolver, err := NewAppPathResolver(path)
+		if err != nil {
+			t.Fatalf("Failed to create AppPathResolver: %v", err)
+		}
+		expectedConfigDir := filepath.Join(prefix, "opt", "e4", ConfigDir)
+		if resolver.ConfigDir() != expectedConfigDir {
+			t.Errorf("Expected config dir to be %s, got %s", expectedConfigDir, resolver.ConfigDir())
+		}
+	})
+
+	t.Run("ResolveExecutable can keep symlinks", func(t *testing.T) {
+		_, _, linkPath := setupInstall(t)
+		t.Setenv("PATH", filepath.Dir(linkPath))
+
+		path, err := ResolveExecutable("binary", WithFollowSymlinks(false))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if path != linkPath {
+			t.Errorf("Expected path to be %s, got %s", linkPath, path)
+		}
+	})
+
+	t.Run("ResolveExecutable returns an error on unknown executable", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+
+		if _, err := ResolveExecutable("binary"); err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+
+		if _, err := ResolveExecutable("./not/existing/binary", WithFollowSymlinks(false)); err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+	})
+}
+
+func TestNewExecutableAppPathResolver(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Failed to get executable: %v", err)
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		t.Fatalf("Failed to resolve executable: %v", err)
+	}
+
+	resolver, err := NewExecutableAppPathResolver()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if resolver.BinaryFile() != executable {
+		t.Errorf("Expected binary file to be %s, got %s", executable, resolver.BinaryFile())
+	}
+
+	expectedConfigDir := filepath.Join(filepath.Dir(executable), "..", ConfigDir)
+	if resolver.ConfigDir() != expectedConfigDir {
+		t.Errorf("Expected config dir to be %s, got %s", expectedConfigDir, resolver.ConfigDir())
+	}
+}
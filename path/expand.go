@@ -0,0 +1,157 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UndefinedVariablesError is returned in strict mode when a path references undefined environment variables
+type UndefinedVariablesError struct {
+	Path  string
+	Names []string
+}
+
+func (e *UndefinedVariablesError) Error() string {
+	return fmt.Sprintf("path %q references undefined environment variables: %s", e.Path, strings.Join(e.Names, ", "))
+}
+
+// ExpandPath expands a leading ~ to the user home directory, and the $VAR, ${VAR} and ${VAR:-default}
+// environment variables references in p. Undefined variables without default expand to an empty string,
+// unless strict is set, in which case an *UndefinedVariablesError is returned.
+func ExpandPath(p string, strict bool) (string, error) {
+	p, err := expandHome(p)
+	if err != nil {
+		return "", err
+	}
+
+	var undefined []string
+	expanded := os.Expand(p, func(ref string) string {
+		value, name, ok := lookupEnvRef(ref)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+
+		return value
+	})
+
+	if strict && len(undefined) > 0 {
+		return "", &UndefinedVariablesError{Path: p, Names: undefined}
+	}
+
+	return expanded, nil
+}
+
+// expandHome expands a leading ~ to the user home directory
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") && !strings.HasPrefix(p, "~"+string(filepath.Separator)) {
+		return p, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, p[1:]), nil
+}
+
+// lookupEnvRef returns the value of a NAME or NAME:-default environment variable reference, as found
+// between the braces of ${NAME:-default}. The default is used when the variable is undefined or empty.
+// ok is false when the variable is undefined without default, name being the referenced variable.
+func lookupEnvRef(ref string) (value, name string, ok bool) {
+	name, defaultValue, hasDefault := ref, "", false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, defaultValue, hasDefault = ref[:i], ref[i+2:], true
+	}
+
+	value, ok = os.LookupEnv(name)
+	if hasDefault && value == "" {
+		return defaultValue, name, true
+	}
+
+	return value, name, ok
+}
+
+// ExpandingResolver is a ConfigDirResolver expanding the home directory and environment variables
+// in paths before resolving them with its parent resolver.
+// To confine expanded paths, use a ConfinedResolver as parent.
+// Environment variables must only be expanded once, so a literal $ produced by an earlier expansion
+// is kept: callers which already expanded them resolve their paths with ResolveExpandedPath.
+type ExpandingResolver struct {
+	parent ConfigDirResolver
+	strict bool
+}
+
+var _ ConfigPathResolver = (*ExpandingResolver)(nil)
+
+// NewExpandingResolver returns a new ExpandingResolver. When strict is set, paths referencing
+// undefined environment variables are rejected.
+func NewExpandingResolver(parent ConfigDirResolver, strict bool) *ExpandingResolver {
+	return &ExpandingResolver{
+		parent: parent,
+		strict: strict,
+	}
+}
+
+// ConfigDir returns the configuration directory of the parent resolver
+func (e *ExpandingResolver) ConfigDir() string {
+	return e.parent.ConfigDir()
+}
+
+// ConfigRelativePath expands and resolves relPath, returning an empty string when the path is rejected.
+// Use ResolveConfigPath to get the rejection reason.
+func (e *ExpandingResolver) ConfigRelativePath(relPath string) string {
+	path, err := e.ResolveConfigPath(relPath)
+	if err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// ResolveConfigPath expands relPath, then resolves it with the parent resolver
+func (e *ExpandingResolver) ResolveConfigPath(relPath string) (string, error) {
+	expanded, err := ExpandPath(relPath, e.strict)
+	if err != nil {
+		return "", err
+	}
+
+	return ResolveConfigPath(e.parent, expanded)
+}
+
+// ResolveExpandedPath resolves relPath, whose environment variables were already expanded by the caller,
+// with the parent resolver. Only a leading ~ is expanded.
+func (e *ExpandingResolver) ResolveExpandedPath(relPath string) (string, error) {
+	expanded, err := expandHome(relPath)
+	if err != nil {
+		return "", err
+	}
+
+	return ResolveConfigPath(e.parent, expanded)
+}
+
+// ResolveConfigPath resolves relPath from the resolver configuration directory,
+// using its ResolveConfigPath method when it implements ConfigPathResolver.
+func ResolveConfigPath(resolver ConfigDirResolver, relPath string) (string, error) {
+	if pathResolver, ok := resolver.(ConfigPathResolver); ok {
+		return pathResolver.ResolveConfigPath(relPath)
+	}
+
+	return resolver.ConfigRelativePath(relPath), nil
+}
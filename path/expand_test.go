@@ -0,0 +1,175 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("HOME", "/home/e4")
+	t.Setenv("CERT_DIR", "/etc/certs")
+	t.Setenv("EMPTY_DIR", "")
+
+	t.Run("ExpandPath expands home and variables", func(t *testing.T) {
+		testCases := map[string]string{
+			"~":                                 "/home/e4",
+			"~/certs/server.pem":                "/home/e4/certs/server.pem",
+			"~e4/certs":                         "~e4/certs",
+			"$CERT_DIR/server.pem":              "/etc/certs/server.pem",
+			"${CERT_DIR}/server.pem":            "/etc/certs/server.pem",
+			"${MISSING_DIR:-/default}/cert.pem": "/default/cert.pem",
+			"${EMPTY_DIR:-/default}/cert.pem":   "/default/cert.pem",
+			"${CERT_DIR:-/default}/cert.pem":    "/etc/certs/cert.pem",
+			"certs/${MISSING_DIR}server.pem":    "certs/server.pem",
+			"relative/server.pem":               "relative/server.pem",
+		}
+
+		for path, expectedPath := range testCases {
+			expanded, err := ExpandPath(path, false)
+			if err != nil {
+				t.Errorf("Expected no error for path %s, got %v", path, err)
+			}
+
+			if expanded != expectedPath {
+				t.Errorf("Expected path %s to expand to %s, got %s", path, expectedPath, expanded)
+			}
+		}
+	})
+
+	t.Run("ExpandPath rejects undefined variables in strict mode", func(t *testing.T) {
+		_, err := ExpandPath("${MISSING_DIR}/$OTHER_MISSING/${EMPTY_DIR}/${DEFAULTED:-x}", true)
+
+		var undefinedErr *UndefinedVariablesError
+		if !errors.As(err, &undefinedErr) {
+			t.Fatalf("Expected an UndefinedVariablesError, got %v", err)
+		}
+
+		expectedNames := []string{"MISSING_DIR", "OTHER_MISSING"}
+		if !reflect.DeepEqual(undefinedErr.Names, expectedNames) {
+			t.Errorf("Expected undefined variables to be %v, got %v", expectedNames, undefinedErr.Names)
+		}
+	})
+
+	t.Run("lookupEnvRef reports undefined variables without default", func(t *testing.T) {
+		testCases := []struct {
+			ref   string
+			value string
+			ok    bool
+		}{
+			{ref: "CERT_DIR", value: "/etc/certs", ok: true},
+			{ref: "EMPTY_DIR", value: "", ok: true},
+			{ref: "EMPTY_DIR:-/default", value: "/default", ok: true},
+			{ref: "MISSING_DIR:-", value: "", ok: true},
+			{ref: "MISSING_DIR", value: "", ok: false},
+		}
+
+		for _, testCase := range testCases {
+			value, name, ok := lookupEnvRef(testCase.ref)
+			if value != testCase.value || ok != testCase.ok {
+				t.Errorf("Expected %s to be (%q, %v), got (%q, %v)", testCase.ref, testCase.value, testCase.ok, value, ok)
+			}
+			if expectedName := strings.Split(testCase.ref, ":-")[0]; name != expectedName {
+				t.Errorf("Expected %s name to be %s, got %s", testCase.ref, expectedName, name)
+			}
+		}
+	})
+}
+
+func TestExpandingResolver(t *testing.T) {
+	t.Setenv("HOME", "/home/e4")
+	t.Setenv("CERT_DIR", "certs")
+
+	appResolver, err := NewAppPathResolver("/opt/e4/bin/binary")
+	if err != nil {
+		t.Fatalf("Failed to create AppPathResolver: %v", err)
+	}
+
+	t.Run("Paths are expanded before being resolved from the config dir", func(t *testing.T) {
+		resolver := NewExpandingResolver(appResolver, false)
+
+		if resolver.ConfigDir() != appResolver.ConfigDir() {
+			t.Errorf("Expected config dir to be %s, got %s", appResolver.ConfigDir(), resolver.ConfigDir())
+		}
+
+		testCases := map[string]string{
+			"${CERT_DIR}/server.pem": "/opt/e4/configs/certs/server.pem",
+			"~/server.pem":           "/home/e4/server.pem",
+			"$MISSING/server.pem":    "/server.pem",
+		}
+
+		for path, expectedPath := range testCases {
+			if resolved := resolver.ConfigRelativePath(path); resolved != expectedPath {
+				t.Errorf("Expected path %s to resolve to %s, got %s", path, expectedPath, resolved)
+			}
+		}
+	})
+
+	t.Run("Already expanded paths only get their home expanded", func(t *testing.T) {
+		resolver := NewExpandingResolver(appResolver, true)
+
+		testCases := map[string]string{
+			"${CERT_DIR}/server.pem": "/opt/e4/configs/${CERT_DIR}/server.pem",
+			"~/server.pem":           "/home/e4/server.pem",
+		}
+
+		for path, expectedPath := range testCases {
+			resolved, err := resolver.ResolveExpandedPath(path)
+			if err != nil {
+				t.Errorf("Expected no error for path %s, got %v", path, err)
+			}
+			if resolved != expectedPath {
+				t.Errorf("Expected path %s to resolve to %s, got %s", path, expectedPath, resolved)
+			}
+		}
+	})
+
+	t.Run("Strict resolver rejects undefined variables", func(t *testing.T) {
+		resolver := NewExpandingResolver(appResolver, true)
+
+		var undefinedErr *UndefinedVariablesError
+		if _, err := resolver.ResolveConfigPath("$MISSING/server.pem"); !errors.As(err, &undefinedErr) {
+			t.Errorf("Expected an UndefinedVariablesError, got %v", err)
+		}
+
+		if resolved := resolver.ConfigRelativePath("$MISSING/server.pem"); resolved != "" {
+			t.Errorf("Expected rejected path to be empty, got %s", resolved)
+		}
+	})
+
+	t.Run("Expanded paths can be confined", func(t *testing.T) {
+		root := t.TempDir()
+		t.Setenv("HOME", root)
+		appResolver, err := NewAppPathResolver(filepath.Join(root, "bin", "binary"))
+		if err != nil {
+			t.Fatalf("Failed to create AppPathResolver: %v", err)
+		}
+
+		resolver := NewExpandingResolver(NewConfinedResolver(appResolver), true)
+
+		var escapeErr *PathEscapeError
+		if _, err := resolver.ResolveConfigPath("~/server.pem"); !errors.As(err, &escapeErr) {
+			t.Errorf("Expected a PathEscapeError, got %v", err)
+		}
+
+		if _, err := resolver.ResolveConfigPath("${CERT_DIR}/server.pem"); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,285 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Default directory names of the binary relative layout, next to ConfigDir:
+//
+//	/opt/e4/bin/binary
+//	/opt/e4/configs
+//	/opt/e4/share/e4
+//	/opt/e4/data
+//	/opt/e4/log
+//	/opt/e4/run
+//	/opt/e4/cache
+var (
+	ShareDir = "share"
+	DataDir  = "data"
+	LogDir   = "log"
+	RunDir   = "run"
+	CacheDir = "cache"
+)
+
+// LayoutMode defines the conventions used to locate the deployment directories
+type LayoutMode int
+
+const (
+	// LayoutAuto selects the mode from the binary location
+	LayoutAuto LayoutMode = iota
+	// LayoutBinaryRelative locates every directory relative to the binary, for development and /opt installs
+	LayoutBinaryRelative
+	// LayoutSystem follows the FHS, for binaries installed in /usr/bin or /usr/local/bin
+	LayoutSystem
+	// LayoutUser follows the XDG base directory specification, for binaries installed in ~/.local/bin
+	LayoutUser
+)
+
+func (m LayoutMode) String() string {
+	switch m {
+	case LayoutBinaryRelative:
+		return "binary-relative"
+	case LayoutSystem:
+		return "system"
+	case LayoutUser:
+		return "user"
+	default:
+		return "auto"
+	}
+}
+
+// systemBinDirs lists the directories holding system wide installed binaries
+var systemBinDirs = []string{"/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin", "/usr/local/sbin"}
+
+// Layout holds the resolved directories of a deployment
+type Layout struct {
+	Config string
+	Share  string
+	Data   string
+	Log    string
+	Run    string
+	Cache  string
+}
+
+// LayoutResolver resolves every directory of the deployment layout.
+// Each directory can be overridden by an environment variable named
+// <PREFIX>_CONFIG_DIR, <PREFIX>_SHARE_DIR, <PREFIX>_DATA_DIR, <PREFIX>_LOG_DIR,
+// <PREFIX>_RUN_DIR or <PREFIX>_CACHE_DIR, the prefix defaulting to the upper cased application name.
+type LayoutResolver struct {
+	appName   string
+	binary    *AppPathResolver
+	mode      LayoutMode
+	envPrefix string
+}
+
+var _ ConfigDirResolver = (*LayoutResolver)(nil)
+
+// LayoutOption defines functions able to alter a LayoutResolver
+type LayoutOption func(*LayoutResolver)
+
+// WithLayoutMode forces the layout mode instead of selecting it from the binary location
+func WithLayoutMode(mode LayoutMode) LayoutOption {
+	return func(l *LayoutResolver) {
+		l.mode = mode
+	}
+}
+
+// WithLayoutEnvPrefix overrides the prefix of the environment variables overriding the directories
+func WithLayoutEnvPrefix(prefix string) LayoutOption {
+	return func(l *LayoutResolver) {
+		l.envPrefix = prefix
+	}
+}
+
+// NewLayoutResolver returns a new LayoutResolver for appName, installed at the binary location.
+func NewLayoutResolver(appName string, binary *AppPathResolver, opts ...LayoutOption) *LayoutResolver {
+	l := &LayoutResolver{
+		appName:   appName,
+		binary:    binary,
+		envPrefix: envPrefix(appName),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if l.mode == LayoutAuto {
+		l.mode = detectLayoutMode(binary.BinaryFile())
+	}
+
+	return l
+}
+
+// Mode returns the layout mode in use
+func (l *LayoutResolver) Mode() LayoutMode {
+	return l.mode
+}
+
+// Layout returns every resolved directory
+func (l *LayoutResolver) Layout() Layout {
+	return Layout{
+		Config: l.ConfigDir(),
+		Share:  l.ShareDir(),
+		Data:   l.DataDir(),
+		Log:    l.LogDir(),
+		Run:    l.RunDir(),
+		Cache:  l.CacheDir(),
+	}
+}
+
+// ConfigDir returns the configuration directory
+func (l *LayoutResolver) ConfigDir() string {
+	return l.resolve("CONFIG_DIR", l.binary.ConfigDir(), filepath.Join(SystemConfigDir, l.appName), func() (string, error) {
+		dir, err := os.UserConfigDir()
+		return filepath.Join(dir, l.appName), err
+	})
+}
+
+// ConfigFile returns the path to the config file, given confFilename as a config file argument
+func (l *LayoutResolver) ConfigFile(confFilename string) string {
+	return filepath.Join(l.ConfigDir(), confFilename)
+}
+
+// ConfigRelativePath resolves a relative filepath from the configuration directory.
+// If the filepath is absolute then it is returned unchanged.
+func (l *LayoutResolver) ConfigRelativePath(relPath string) string {
+	if filepath.IsAbs(relPath) {
+		return relPath
+	}
+	return filepath.Join(l.ConfigDir(), relPath)
+}
+
+// ShareDir returns the directory holding read-only application data, such as configuration templates
+func (l *LayoutResolver) ShareDir() string {
+	return l.resolve("SHARE_DIR", l.prefixPath(ShareDir, l.appName), filepath.Join(l.systemPrefix(), "share", l.appName), func() (string, error) {
+		return xdgDir(l.appName, "XDG_DATA_HOME", ".local", "share")
+	})
+}
+
+// DataDir returns the directory holding persistent application data, such as SQLite files
+func (l *LayoutResolver) DataDir() string {
+	return l.resolve("DATA_DIR", l.prefixPath(DataDir), filepath.Join("/var/lib", l.appName), func() (string, error) {
+		dir, err := xdgDir(l.appName, "XDG_STATE_HOME", ".local", "state")
+		return filepath.Join(dir, DataDir), err
+	})
+}
+
+// LogDir returns the directory holding log files
+func (l *LayoutResolver) LogDir() string {
+	return l.resolve("LOG_DIR", l.prefixPath(LogDir), filepath.Join("/var/log", l.appName), func() (string, error) {
+		dir, err := xdgDir(l.appName, "XDG_STATE_HOME", ".local", "state")
+		return filepath.Join(dir, LogDir), err
+	})
+}
+
+// RunDir returns the directory holding runtime files, such as PID files and sockets
+func (l *LayoutResolver) RunDir() string {
+	return l.resolve("RUN_DIR", l.prefixPath(RunDir), filepath.Join("/run", l.appName), func() (string, error) {
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			return filepath.Join(dir, l.appName), nil
+		}
+		return filepath.Join(os.TempDir(), l.appName), nil
+	})
+}
+
+// CacheDir returns the directory holding disposable cached data
+func (l *LayoutResolver) CacheDir() string {
+	return l.resolve("CACHE_DIR", l.prefixPath(CacheDir), filepath.Join("/var/cache", l.appName), func() (string, error) {
+		dir, err := os.UserCacheDir()
+		return filepath.Join(dir, l.appName), err
+	})
+}
+
+// resolve returns the directory from the environment override when defined, or the one of the layout mode.
+func (l *LayoutResolver) resolve(envSuffix, binaryRelative, system string, user func() (string, error)) string {
+	if dir := os.Getenv(l.envPrefix + "_" + envSuffix); dir != "" {
+		return dir
+	}
+
+	switch l.mode {
+	case LayoutSystem:
+		return system
+	case LayoutUser:
+		dir, err := user()
+		if err != nil {
+			// no usable home directory, fallback on the binary relative layout
+			return binaryRelative
+		}
+		return dir
+	default:
+		return binaryRelative
+	}
+}
+
+// prefixPath returns a path from the installation prefix, the parent of the binary directory
+func (l *LayoutResolver) prefixPath(elem ...string) string {
+	return filepath.Join(append([]string{l.binary.absolutePrefixPath, ".."}, elem...)...)
+}
+
+// systemPrefix returns /usr/local for binaries installed in /usr/local, /usr otherwise
+func (l *LayoutResolver) systemPrefix() string {
+	if strings.HasPrefix(l.binary.absolutePrefixPath, "/usr/local/") {
+		return "/usr/local"
+	}
+	return "/usr"
+}
+
+func detectLayoutMode(binaryPath string) LayoutMode {
+	binDir, err := filepath.Abs(filepath.Dir(binaryPath))
+	if err != nil {
+		return LayoutBinaryRelative
+	}
+
+	for _, systemBinDir := range systemBinDirs {
+		if binDir == systemBinDir {
+			return LayoutSystem
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && binDir == filepath.Join(home, ".local", "bin") {
+		return LayoutUser
+	}
+
+	return LayoutBinaryRelative
+}
+
+// xdgDir returns the appName directory in the XDG base directory defined by envName,
+// or in its default location from the home directory
+func xdgDir(appName, envName string, defaultFromHome ...string) (string, error) {
+	if dir := os.Getenv(envName); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(append(append([]string{home}, defaultFromHome...), appName)...), nil
+}
+
+// envPrefix returns the upper cased appName, with non alphanumeric characters replaced by underscores
+func envPrefix(appName string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, appName)
+}
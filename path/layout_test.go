@@ -0,0 +1,135 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLayoutResolver(t *testing.T) {
+	newLayoutResolver := func(t *testing.T, binaryPath string, opts ...LayoutOption) *LayoutResolver {
+		binary, err := NewAppPathResolver(binaryPath)
+		if err != nil {
+			t.Fatalf("Failed to create AppPathResolver: %v", err)
+		}
+
+		return NewLayoutResolver("e4-c2", binary, opts...)
+	}
+
+	t.Run("Binary relative layout is used for /opt installs", func(t *testing.T) {
+		resolver := newLayoutResolver(t, "/opt/e4/bin/c2")
+
+		if resolver.Mode() != LayoutBinaryRelative {
+			t.Errorf("Expected mode to be %v, got %v", LayoutBinaryRelative, resolver.Mode())
+		}
+
+		expectedLayout := Layout{
+			Config: "/opt/e4/configs",
+			Share:  "/opt/e4/share/e4-c2",
+			Data:   "/opt/e4/data",
+			Log:    "/opt/e4/log",
+			Run:    "/opt/e4/run",
+			Cache:  "/opt/e4/cache",
+		}
+		if resolver.Layout() != expectedLayout {
+			t.Errorf("Expected layout to be %#v, got %#v", expectedLayout, resolver.Layout())
+		}
+	})
+
+	t.Run("System layout is used for /usr/local/bin installs", func(t *testing.T) {
+		resolver := newLayoutResolver(t, "/usr/local/bin/c2")
+
+		if resolver.Mode() != LayoutSystem {
+			t.Errorf("Expected mode to be %v, got %v", LayoutSystem, resolver.Mode())
+		}
+
+		expectedLayout := Layout{
+			Config: "/etc/e4-c2",
+			Share:  "/usr/local/share/e4-c2",
+			Data:   "/var/lib/e4-c2",
+			Log:    "/var/log/e4-c2",
+			Run:    "/run/e4-c2",
+			Cache:  "/var/cache/e4-c2",
+		}
+		if resolver.Layout() != expectedLayout {
+			t.Errorf("Expected layout to be %#v, got %#v", expectedLayout, resolver.Layout())
+		}
+
+		if share := newLayoutResolver(t, "/usr/bin/c2").ShareDir(); share != "/usr/share/e4-c2" {
+			t.Errorf("Expected share dir to be /usr/share/e4-c2, got %s", share)
+		}
+	})
+
+	t.Run("User layout follows XDG directories", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("XDG_CONFIG_HOME", "")
+		t.Setenv("XDG_DATA_HOME", "")
+		t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+		t.Setenv("XDG_CACHE_HOME", "")
+		t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+
+		resolver := newLayoutResolver(t, filepath.Join(home, ".local", "bin", "c2"))
+
+		if resolver.Mode() != LayoutUser {
+			t.Errorf("Expected mode to be %v, got %v", LayoutUser, resolver.Mode())
+		}
+
+		expectedLayout := Layout{
+			Config: filepath.Join(home, ".config", "e4-c2"),
+			Share:  filepath.Join(home, ".local", "share", "e4-c2"),
+			Data:   filepath.Join(home, "state", "e4-c2", DataDir),
+			Log:    filepath.Join(home, "state", "e4-c2", LogDir),
+			Run:    "/run/user/1000/e4-c2",
+			Cache:  filepath.Join(home, ".cache", "e4-c2"),
+		}
+		if resolver.Layout() != expectedLayout {
+			t.Errorf("Expected layout to be %#v, got %#v", expectedLayout, resolver.Layout())
+		}
+	})
+
+	t.Run("Environment variables override the layout", func(t *testing.T) {
+		t.Setenv("E4_C2_CONFIG_DIR", "/custom/configs")
+		t.Setenv("E4_C2_LOG_DIR", "/custom/log")
+		t.Setenv("C2_RUN_DIR", "/custom/run")
+
+		resolver := newLayoutResolver(t, "/usr/bin/c2", WithLayoutMode(LayoutBinaryRelative))
+
+		if resolver.ConfigDir() != "/custom/configs" {
+			t.Errorf("Expected config dir to be /custom/configs, got %s", resolver.ConfigDir())
+		}
+		if resolver.LogDir() != "/custom/log" {
+			t.Errorf("Expected log dir to be /custom/log, got %s", resolver.LogDir())
+		}
+		if resolver.DataDir() != "/usr/data" {
+			t.Errorf("Expected data dir to be /usr/data, got %s", resolver.DataDir())
+		}
+		if path := resolver.ConfigRelativePath("cert.pem"); path != "/custom/configs/cert.pem" {
+			t.Errorf("Expected path to be /custom/configs/cert.pem, got %s", path)
+		}
+		if path := resolver.ConfigFile("c2.yaml"); path != "/custom/configs/c2.yaml" {
+			t.Errorf("Expected path to be /custom/configs/c2.yaml, got %s", path)
+		}
+
+		prefixed := newLayoutResolver(t, "/opt/e4/bin/c2", WithLayoutEnvPrefix("C2"))
+		if prefixed.RunDir() != "/custom/run" {
+			t.Errorf("Expected run dir to be /custom/run, got %s", prefixed.RunDir())
+		}
+		if prefixed.ConfigDir() != "/opt/e4/configs" {
+			t.Errorf("Expected config dir to be /opt/e4/configs, got %s", prefixed.ConfigDir())
+		}
+	})
+}
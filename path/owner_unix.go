@@ -0,0 +1,41 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package path
+
+import (
+	"os"
+	"syscall"
+)
+
+// isOwnedByCurrentUser returns true when the file belongs to the effective user
+func isOwnedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+
+	return int(stat.Uid) == os.Geteuid()
+}
+
+// accessWrite is the W_OK mode of the access syscall
+const accessWrite = 0x2
+
+// hasWriteAccess returns true when the current user is granted write access to path,
+// without modifying it
+func hasWriteAccess(path string) bool {
+	return syscall.Access(path, accessWrite) == nil
+}
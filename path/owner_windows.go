@@ -0,0 +1,34 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package path
+
+import "os"
+
+// isOwnedByCurrentUser always returns true, as ownership is not checked on windows
+func isOwnedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
+
+// hasWriteAccess returns true when path is not read-only, without modifying it
+func hasWriteAccess(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return info.Mode().Perm()&0200 != 0
+}
@@ -42,6 +42,10 @@
 // 	GITREPO/configs/projectconf.yaml
 //
 // etc. So this logic works both for development and for production scenarios.
+//
+// LayoutResolver extends this layout with the share, data, log, run and cache
+// directories, and follows the FHS or XDG conventions when the binary is installed
+// system wide or in the user home.
 package path
 
 import (
@@ -65,6 +69,7 @@ type AppPathResolver struct {
 
 // NewAppPathResolver returns a new instance of the AppPathResolver
 // binaryPath is the path to the current executable, usually argv[0].
+// See NewExecutableAppPathResolver when the binary may be invoked from $PATH or through a symlink.
 func NewAppPathResolver(binaryPath string) (*AppPathResolver, error) {
 	dir, err := filepath.Abs(filepath.Dir(binaryPath))
 	if err != nil {
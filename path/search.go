@@ -0,0 +1,198 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrCandidateNotSet is returned when a candidate source does not define any directory
+	ErrCandidateNotSet = errors.New("not set")
+	// ErrCandidateNotFound is returned when a candidate directory does not exist
+	ErrCandidateNotFound = errors.New("directory does not exist")
+	// ErrCandidateNotDir is returned when a candidate path is not a directory
+	ErrCandidateNotDir = errors.New("not a directory")
+	// ErrCandidateLowerPriority is reported for candidates skipped because a previous one was selected
+	ErrCandidateLowerPriority = errors.New("a higher priority candidate was selected")
+	// ErrNoConfigDir is returned when no candidate can be selected
+	ErrNoConfigDir = errors.New("no configuration directory found")
+)
+
+// SystemConfigDir is the root of system wide configuration directories
+var SystemConfigDir = "/etc"
+
+// ConfigDirCandidate defines a possible location of the configuration directory
+type ConfigDirCandidate struct {
+	// Source describes where the candidate comes from, such as "flag" or "$E4_CONFIG_DIR"
+	Source string
+	// Dir is the candidate directory, empty when the source does not define any
+	Dir string
+	// Required makes the search fail when the candidate is rejected, instead of trying the next one
+	Required bool
+}
+
+// ConfigDirCandidateResult holds the outcome of a candidate evaluation
+type ConfigDirCandidateResult struct {
+	Candidate ConfigDirCandidate
+	// Rejection explains why the candidate was not selected, nil for the selected one
+	Rejection error
+}
+
+// FlagCandidate returns a candidate for a directory given on the command line.
+// It is required when set, so a mistyped flag does not silently fall back to another directory.
+func FlagCandidate(dir string) ConfigDirCandidate {
+	return ConfigDirCandidate{Source: "flag", Dir: dir, Required: dir != ""}
+}
+
+// EnvCandidate returns a candidate for a directory given by the envName environment variable
+func EnvCandidate(envName string) ConfigDirCandidate {
+	return ConfigDirCandidate{Source: "$" + envName, Dir: os.Getenv(envName)}
+}
+
+// XDGCandidate returns a candidate for the user configuration directory of appName,
+// usually $XDG_CONFIG_HOME/appName or ~/.config/appName
+func XDGCandidate(appName string) ConfigDirCandidate {
+	candidate := ConfigDirCandidate{Source: "xdg"}
+	if userConfigDir, err := os.UserConfigDir(); err == nil {
+		candidate.Dir = filepath.Join(userConfigDir, appName)
+	}
+
+	return candidate
+}
+
+// SystemCandidate returns a candidate for the system wide configuration directory of appName, /etc/appName
+func SystemCandidate(appName string) ConfigDirCandidate {
+	return ConfigDirCandidate{Source: "system", Dir: filepath.Join(SystemConfigDir, appName)}
+}
+
+// BinaryRelativeCandidate returns a candidate for the configuration directory relative to the binary
+func BinaryRelativeCandidate(resolver *AppPathResolver) ConfigDirCandidate {
+	return ConfigDirCandidate{Source: "binary", Dir: resolver.ConfigDir()}
+}
+
+// DefaultConfigDirCandidates returns the default search order: the flagDir, the envName environment variable,
+// the XDG user configuration, the system configuration and finally the directory relative to the binary.
+func DefaultConfigDirCandidates(appName, flagDir, envName string, resolver *AppPathResolver) []ConfigDirCandidate {
+	return []ConfigDirCandidate{
+		FlagCandidate(flagDir),
+		EnvCandidate(envName),
+		XDGCandidate(appName),
+		SystemCandidate(appName),
+		BinaryRelativeCandidate(resolver),
+	}
+}
+
+// SearchPathResolver resolves the configuration directory as the first existing candidate of a search path.
+type SearchPathResolver struct {
+	selected ConfigDirCandidate
+	results  []ConfigDirCandidateResult
+}
+
+var _ ConfigDirResolver = (*SearchPathResolver)(nil)
+
+// NewSearchPathResolver returns a new SearchPathResolver, selecting the first existing candidate directory.
+// An error is returned when none of the candidates exists or when a required one is rejected.
+func NewSearchPathResolver(candidates ...ConfigDirCandidate) (*SearchPathResolver, error) {
+	resolver := &SearchPathResolver{}
+
+	selected := false
+	for _, candidate := range candidates {
+		result := ConfigDirCandidateResult{Candidate: candidate}
+
+		if selected {
+			result.Rejection = ErrCandidateLowerPriority
+		} else if result.Rejection = checkCandidate(candidate); result.Rejection == nil {
+			dir, err := filepath.Abs(candidate.Dir)
+			if err != nil {
+				return nil, err
+			}
+			resolver.selected = candidate
+			resolver.selected.Dir = dir
+			selected = true
+		} else if candidate.Required {
+			return nil, fmt.Errorf("config dir from %s rejected: %w", candidate.Source, result.Rejection)
+		}
+
+		resolver.results = append(resolver.results, result)
+	}
+
+	if !selected {
+		return nil, fmt.Errorf("%w: %s", ErrNoConfigDir, resolver.rejections())
+	}
+
+	return resolver, nil
+}
+
+func checkCandidate(candidate ConfigDirCandidate) error {
+	if candidate.Dir == "" {
+		return ErrCandidateNotSet
+	}
+
+	info, err := os.Stat(candidate.Dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrCandidateNotFound, candidate.Dir)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrCandidateNotDir, candidate.Dir)
+	}
+
+	return nil
+}
+
+func (s *SearchPathResolver) rejections() string {
+	var reasons []string
+	for _, result := range s.results {
+		reasons = append(reasons, fmt.Sprintf("%s: %v", result.Candidate.Source, result.Rejection))
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+// Selected returns the candidate selected as configuration directory, its Dir being absolute
+func (s *SearchPathResolver) Selected() ConfigDirCandidate {
+	return s.selected
+}
+
+// Results returns the evaluation result of every candidate, in search order
+func (s *SearchPathResolver) Results() []ConfigDirCandidateResult {
+	return s.results
+}
+
+// ConfigDir returns the selected configuration directory
+func (s *SearchPathResolver) ConfigDir() string {
+	return s.selected.Dir
+}
+
+// ConfigFile returns the path to the config file, given confFilename as a config file argument
+func (s *SearchPathResolver) ConfigFile(confFilename string) string {
+	return filepath.Join(s.ConfigDir(), confFilename)
+}
+
+// ConfigRelativePath resolves a relative filepath from the selected configuration directory.
+// If the filepath is absolute then it is returned unchanged.
+func (s *SearchPathResolver) ConfigRelativePath(relPath string) string {
+	if filepath.IsAbs(relPath) {
+		return relPath
+	}
+	return filepath.Join(s.ConfigDir(), relPath)
+}
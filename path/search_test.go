@@ -0,0 +1,156 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchPathResolver(t *testing.T) {
+	mkdir := func(t *testing.T, path ...string) string {
+		dir := filepath.Join(path...)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+
+		return dir
+	}
+
+	t.Run("NewSearchPathResolver selects the first existing candidate", func(t *testing.T) {
+		root := t.TempDir()
+		envDir := mkdir(t, root, "env")
+		systemDir := mkdir(t, root, "etc", "e4")
+		t.Setenv("E4_CONFIG_DIR", envDir)
+
+		resolver, err := NewSearchPathResolver(
+			FlagCandidate(""),
+			EnvCandidate("E4_CONFIG_DIR"),
+			ConfigDirCandidate{Source: "system", Dir: systemDir},
+		)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if resolver.ConfigDir() != envDir {
+			t.Errorf("Expected config dir to be %s, got %s", envDir, resolver.ConfigDir())
+		}
+		if resolver.Selected().Source != "$E4_CONFIG_DIR" {
+			t.Errorf("Expected selected source to be $E4_CONFIG_DIR, got %s", resolver.Selected().Source)
+		}
+
+		expectedRejections := []error{ErrCandidateNotSet, nil, ErrCandidateLowerPriority}
+		results := resolver.Results()
+		if len(results) != len(expectedRejections) {
+			t.Fatalf("Expected %d results, got %d", len(expectedRejections), len(results))
+		}
+		for i, expectedRejection := range expectedRejections {
+			if !errors.Is(results[i].Rejection, expectedRejection) {
+				t.Errorf("Expected result %d rejection to be %v, got %v", i, expectedRejection, results[i].Rejection)
+			}
+		}
+
+		expectedPath := filepath.Join(envDir, "cert.pem")
+		if path := resolver.ConfigRelativePath("cert.pem"); path != expectedPath {
+			t.Errorf("Expected path to be %s, got %s", expectedPath, path)
+		}
+		if path := resolver.ConfigRelativePath("/abs/cert.pem"); path != "/abs/cert.pem" {
+			t.Errorf("Expected path to be /abs/cert.pem, got %s", path)
+		}
+		expectedFile := filepath.Join(envDir, "config.yaml")
+		if path := resolver.ConfigFile("config.yaml"); path != expectedFile {
+			t.Errorf("Expected path to be %s, got %s", expectedFile, path)
+		}
+	})
+
+	t.Run("NewSearchPathResolver reports why candidates are rejected", func(t *testing.T) {
+		root := t.TempDir()
+		file := filepath.Join(root, "file")
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		binaryDir := mkdir(t, root, "configs")
+
+		resolver, err := NewSearchPathResolver(
+			ConfigDirCandidate{Source: "missing", Dir: filepath.Join(root, "missing")},
+			ConfigDirCandidate{Source: "file", Dir: file},
+			ConfigDirCandidate{Source: "binary", Dir: binaryDir},
+		)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if resolver.ConfigDir() != binaryDir {
+			t.Errorf("Expected config dir to be %s, got %s", binaryDir, resolver.ConfigDir())
+		}
+
+		expectedRejections := []error{ErrCandidateNotFound, ErrCandidateNotDir, nil}
+		for i, expectedRejection := range expectedRejections {
+			if !errors.Is(resolver.Results()[i].Rejection, expectedRejection) {
+				t.Errorf("Expected result %d rejection to be %v, got %v", i, expectedRejection, resolver.Results()[i].Rejection)
+			}
+		}
+	})
+
+	t.Run("NewSearchPathResolver fails when a required candidate is rejected", func(t *testing.T) {
+		root := t.TempDir()
+
+		_, err := NewSearchPathResolver(
+			FlagCandidate(filepath.Join(root, "missing")),
+			ConfigDirCandidate{Source: "fallback", Dir: root},
+		)
+		if !errors.Is(err, ErrCandidateNotFound) {
+			t.Errorf("Expected error to be %v, got %v", ErrCandidateNotFound, err)
+		}
+	})
+
+	t.Run("NewSearchPathResolver fails when no candidate exists", func(t *testing.T) {
+		_, err := NewSearchPathResolver(EnvCandidate("E4_NOT_DEFINED_CONFIG_DIR"))
+		if !errors.Is(err, ErrNoConfigDir) {
+			t.Errorf("Expected error to be %v, got %v", ErrNoConfigDir, err)
+		}
+	})
+
+	t.Run("DefaultConfigDirCandidates returns the expected search order", func(t *testing.T) {
+		root := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "xdg"))
+		t.Setenv("E4_CONFIG_DIR", filepath.Join(root, "env"))
+
+		appResolver, err := NewAppPathResolver(filepath.Join(root, "bin", "binary"))
+		if err != nil {
+			t.Fatalf("Failed to create AppPathResolver: %v", err)
+		}
+
+		candidates := DefaultConfigDirCandidates("e4", "", "E4_CONFIG_DIR", appResolver)
+
+		expectedCandidates := []ConfigDirCandidate{
+			{Source: "flag"},
+			{Source: "$E4_CONFIG_DIR", Dir: filepath.Join(root, "env")},
+			{Source: "xdg", Dir: filepath.Join(root, "xdg", "e4")},
+			{Source: "system", Dir: filepath.Join(SystemConfigDir, "e4")},
+			{Source: "binary", Dir: appResolver.ConfigDir()},
+		}
+		if len(candidates) != len(expectedCandidates) {
+			t.Fatalf("Expected %d candidates, got %d", len(expectedCandidates), len(candidates))
+		}
+		for i, expectedCandidate := range expectedCandidates {
+			if candidates[i] != expectedCandidate {
+				t.Errorf("Expected candidate %d to be %#v, got %#v", i, expectedCandidate, candidates[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,257 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tlsconfig builds hardened TLS server configurations from the configuration files,
+// so every server applies the same protocol versions and cipher suites.
+//
+//	var tlsCfg tlsconfig.ServerCfg
+//	loader.Load(tlsCfg.ViperCfgFields("grpc"))
+//
+//	serverTLSConfig, err := tlsCfg.TLSConfig()
+//
+// The certificate, key and client CA files are reloaded when they change on disk.
+// Client certificates are mapped to an Identity, restricted by allow-lists, and made available
+// to the handlers with IdentityFromContext. An ExpiryMonitor warns before the certificates expire.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+// List of supported TLS minimum versions
+const (
+	Version12 = "1.2"
+	Version13 = "1.3"
+)
+
+// List of supported client authentication modes
+const (
+	// ClientAuthNone does not request client certificates
+	ClientAuthNone = "none"
+	// ClientAuthRequest requests a client certificate, without requiring nor verifying it.
+	// Clients can only be identified by their SPKI pin.
+	ClientAuthRequest = "request"
+	// ClientAuthRequireAny requires a client certificate, without verifying it.
+	// Clients can only be identified by their SPKI pin.
+	ClientAuthRequireAny = "require-any"
+	// ClientAuthVerifyIfGiven verifies the client certificate against the client CA when one is sent
+	ClientAuthVerifyIfGiven = "verify-if-given"
+	// ClientAuthRequireAndVerify requires a client certificate signed by the client CA
+	ClientAuthRequireAndVerify = "require-and-verify"
+)
+
+// List of supported cipher policies
+const (
+	// CipherPolicyModern only accepts TLS 1.3, whose cipher suites are all considered secure
+	CipherPolicyModern = "modern"
+	// CipherPolicyIntermediate restricts TLS 1.2 to forward secret AEAD cipher suites
+	CipherPolicyIntermediate = "intermediate"
+	// CipherPolicyCompatible also accepts the forward secret CBC cipher suites on TLS 1.2, for older clients
+	CipherPolicyCompatible = "compatible"
+)
+
+var intermediateCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+var compatibleCipherSuites = append(append([]uint16{}, intermediateCipherSuites...),
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+)
+
+// ServerCfg holds the TLS configuration of a server
+type ServerCfg struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the certificates used to verify the client certificates, in PEM format
+	ClientCAFile string
+	MinVersion   string
+	// ClientAuth is one of the ClientAuth modes. When empty, it defaults to ClientAuthRequireAndVerify
+	// when a ClientCAFile is set, and ClientAuthNone otherwise.
+	ClientAuth   string
+	CipherPolicy string
+	// ClientIdentity maps the client certificates to identities, rejecting the ones not allowed
+	ClientIdentity ClientIdentityCfg
+}
+
+// ViperCfgFields returns the list of configuration fields needed to load a ServerCfg.
+// The keys are prefixed with prefix, such as grpc-tls-cert for the "grpc" prefix, or tls-cert without prefix.
+// File paths are resolved from the configuration directory.
+func (c *ServerCfg) ViperCfgFields(prefix string) []config.ViperCfgField {
+	key := func(name string) string {
+		if prefix == "" {
+			return "tls-" + name
+		}
+		return prefix + "-tls-" + name
+	}
+
+	return []config.ViperCfgField{
+		{Target: &c.CertFile, KeyName: key("cert"), CfgType: config.ViperRelativePath},
+		{Target: &c.KeyFile, KeyName: key("key"), CfgType: config.ViperRelativePath},
+		{Target: &c.ClientCAFile, KeyName: key("client-ca"), CfgType: config.ViperRelativePath},
+		{Target: &c.MinVersion, KeyName: key("min-version"), CfgType: config.ViperString, DefaultValue: Version12},
+		{Target: &c.ClientAuth, KeyName: key("client-auth"), CfgType: config.ViperString},
+		{Target: &c.CipherPolicy, KeyName: key("cipher-policy"), CfgType: config.ViperString, DefaultValue: CipherPolicyIntermediate},
+		{Target: &c.ClientIdentity.Source, KeyName: key("identity-source"), CfgType: config.ViperString, DefaultValue: IdentitySourceCommonName},
+		{Target: &c.ClientIdentity.AllowedSubjects, KeyName: key("allowed-subjects"), CfgType: config.ViperStringSlice, DefaultValue: []string{}},
+		{Target: &c.ClientIdentity.AllowedSANs, KeyName: key("allowed-sans"), CfgType: config.ViperStringSlice, DefaultValue: []string{}},
+		{Target: &c.ClientIdentity.AllowedSPKIPins, KeyName: key("allowed-spki-pins"), CfgType: config.ViperStringSlice, DefaultValue: []string{}},
+	}
+}
+
+// Validate checks the configuration is usable
+func (c ServerCfg) Validate() error {
+	if c.CertFile == "" {
+		return errors.New("TLS certificate file is required")
+	}
+	if c.KeyFile == "" {
+		return errors.New("TLS key file is required")
+	}
+
+	if _, err := c.minVersion(); err != nil {
+		return err
+	}
+	if _, err := c.cipherSuites(); err != nil {
+		return err
+	}
+
+	clientAuth, err := c.clientAuth()
+	if err != nil {
+		return err
+	}
+	if clientAuth >= tls.VerifyClientCertIfGiven && c.ClientCAFile == "" {
+		return fmt.Errorf("TLS client CA file is required for client auth %s", c.ClientAuth)
+	}
+
+	if err := c.ClientIdentity.Validate(); err != nil {
+		return err
+	}
+	if c.ClientIdentity.restricted() && clientAuth == tls.NoClientCert {
+		return errors.New("TLS client identity allow-lists require a client auth mode")
+	}
+	if clientAuth == tls.RequestClientCert || clientAuth == tls.RequireAnyClientCert {
+		// the client certificates are not verified, so anyone can forge their subject and SANs
+		if len(c.ClientIdentity.AllowedSubjects) > 0 || len(c.ClientIdentity.AllowedSANs) > 0 {
+			return fmt.Errorf("TLS client subject and SAN allow-lists require client auth %s or %s, only SPKI pins are allowed with %s",
+				ClientAuthVerifyIfGiven, ClientAuthRequireAndVerify, c.ClientAuth)
+		}
+		if c.ClientIdentity.Source != IdentitySourceSPKI {
+			return fmt.Errorf("TLS identity source %q requires client auth %s or %s, only %s is allowed with %s",
+				c.ClientIdentity.Source, ClientAuthVerifyIfGiven, ClientAuthRequireAndVerify, IdentitySourceSPKI, c.ClientAuth)
+		}
+	}
+
+	return nil
+}
+
+// TLSConfig validates the configuration and returns a hardened server *tls.Config,
+// reloading the certificate, key and client CA files when they change on disk.
+// Use NewReloader to get the reload errors or alter the check interval.
+func (c ServerCfg) TLSConfig() (*tls.Config, error) {
+	reloader, err := NewReloader(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader.TLSConfig(), nil
+}
+
+// baseTLSConfig returns the tls.Config without certificates nor client CAs
+func (c ServerCfg) baseTLSConfig() (*tls.Config, error) {
+	minVersion, err := c.minVersion()
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := c.cipherSuites()
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := c.clientAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.CipherPolicy == CipherPolicyModern {
+		minVersion = tls.VersionTLS13
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:       minVersion,
+		CipherSuites:     cipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+		ClientAuth:       clientAuth,
+	}
+	if clientAuth != tls.NoClientCert {
+		tlsConfig.VerifyPeerCertificate = c.ClientIdentity.verifyPeerCertificate
+	}
+
+	return tlsConfig, nil
+}
+
+func (c ServerCfg) minVersion() (uint16, error) {
+	switch c.MinVersion {
+	case Version12, "":
+		return tls.VersionTLS12, nil
+	case Version13:
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS min version %q, must be one of %s, %s", c.MinVersion, Version12, Version13)
+	}
+}
+
+func (c ServerCfg) cipherSuites() ([]uint16, error) {
+	switch c.CipherPolicy {
+	case CipherPolicyModern:
+		return nil, nil
+	case CipherPolicyIntermediate, "":
+		return intermediateCipherSuites, nil
+	case CipherPolicyCompatible:
+		return compatibleCipherSuites, nil
+	default:
+		return nil, fmt.Errorf("unsupported TLS cipher policy %q", c.CipherPolicy)
+	}
+}
+
+func (c ServerCfg) clientAuth() (tls.ClientAuthType, error) {
+	switch c.ClientAuth {
+	case "":
+		if c.ClientCAFile != "" {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	case ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthRequireAny:
+		return tls.RequireAnyClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequireAndVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS client auth %q", c.ClientAuth)
+	}
+}
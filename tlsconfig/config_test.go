@@ -0,0 +1,373 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teserakt-io/serverlib/config/configtest"
+)
+
+// testCert holds a generated certificate, written in PEM files
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert writes a certificate for commonName and its key in dir, signed by parent or self-signed when nil.
+// The alter functions can modify the certificate template before signing.
+func newTestCert(t *testing.T, dir, name, commonName string, parent *testCert, isCA bool, alter ...func(*x509.Certificate)) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("failed to generate serial: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	for _, f := range alter {
+		f(template)
+	}
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err := os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return c
+}
+
+// handshake connects a client to a server using serverConfig, and returns the server connection state
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+
+	// TCP rather than net.Pipe, whose unbuffered writes deadlock when the server aborts a handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer clientConn.Close()
+
+	serverConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer serverConn.Close()
+
+	// the client waits for a byte from the server, as TLS 1.3 servers verify
+	// the client certificate after the client handshake completion
+	clientErr := make(chan error, 1)
+	go func() {
+		client := tls.Client(clientConn, clientConfig)
+		_, err := client.Read(make([]byte, 1))
+		clientErr <- err
+	}()
+
+	server := tls.Server(serverConn, serverConfig)
+	if err := server.Handshake(); err != nil {
+		serverConn.Close()
+		<-clientErr
+		return tls.ConnectionState{}, err
+	}
+	if _, err := server.Write([]byte{0}); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	if err := <-clientErr; err != nil {
+		return tls.ConnectionState{}, err
+	}
+
+	return server.ConnectionState(), nil
+}
+
+func TestServerCfgValidate(t *testing.T) {
+	valid := ServerCfg{CertFile: "cert.pem", KeyFile: "key.pem"}
+
+	testData := []struct {
+		name        string
+		alter       func(c *ServerCfg)
+		expectError bool
+	}{
+		{name: "valid", alter: func(c *ServerCfg) {}},
+		{name: "missing cert", alter: func(c *ServerCfg) { c.CertFile = "" }, expectError: true},
+		{name: "missing key", alter: func(c *ServerCfg) { c.KeyFile = "" }, expectError: true},
+		{name: "tls 1.3", alter: func(c *ServerCfg) { c.MinVersion = Version13 }},
+		{name: "tls 1.1", alter: func(c *ServerCfg) { c.MinVersion = "1.1" }, expectError: true},
+		{name: "compatible policy", alter: func(c *ServerCfg) { c.CipherPolicy = CipherPolicyCompatible }},
+		{name: "unknown policy", alter: func(c *ServerCfg) { c.CipherPolicy = "weak" }, expectError: true},
+		{name: "unknown client auth", alter: func(c *ServerCfg) { c.ClientAuth = "maybe" }, expectError: true},
+		{name: "verify without client CA", alter: func(c *ServerCfg) { c.ClientAuth = ClientAuthRequireAndVerify }, expectError: true},
+		{name: "verify with client CA", alter: func(c *ServerCfg) {
+			c.ClientAuth = ClientAuthVerifyIfGiven
+			c.ClientCAFile = "ca.pem"
+		}},
+		{name: "request without client CA", alter: func(c *ServerCfg) {
+			c.ClientAuth = ClientAuthRequest
+			c.ClientIdentity.Source = IdentitySourceSPKI
+		}},
+		{name: "request with common name source", alter: func(c *ServerCfg) { c.ClientAuth = ClientAuthRequest }, expectError: true},
+		{name: "require any with subject allow-list", alter: func(c *ServerCfg) {
+			c.ClientAuth = ClientAuthRequireAny
+			c.ClientIdentity = ClientIdentityCfg{Source: IdentitySourceSPKI, AllowedSubjects: []string{"client"}}
+		}, expectError: true},
+		{name: "require any with SAN allow-list", alter: func(c *ServerCfg) {
+			c.ClientAuth = ClientAuthRequireAny
+			c.ClientIdentity = ClientIdentityCfg{Source: IdentitySourceSPKI, AllowedSANs: []string{"client"}}
+		}, expectError: true},
+		{name: "require any with SPKI pins", alter: func(c *ServerCfg) {
+			c.ClientAuth = ClientAuthRequireAny
+			c.ClientIdentity = ClientIdentityCfg{Source: IdentitySourceSPKI, AllowedSPKIPins: []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}}
+		}},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			cfg := valid
+			data.alter(&cfg)
+
+			err := cfg.Validate()
+			if data.expectError && err == nil {
+				t.Error("Expected an error")
+			}
+			if !data.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServerCfgViperCfgFields(t *testing.T) {
+	var cfg ServerCfg
+	fields := cfg.ViperCfgFields("grpc")
+	loader, resolver := configtest.NewLoaderWithResolver(t, "yaml", "grpc-tls-cert: server.pem\ngrpc-tls-key: server.key\n")
+	ca := newTestCert(t, resolver.ConfigDir(), "ca", "Test CA", nil, true)
+	newTestCert(t, resolver.ConfigDir(), "server", "localhost", ca, false)
+	configtest.MustLoad(t, loader, fields)
+
+	configtest.AssertFields(t, fields, map[string]interface{}{
+		"grpc-tls-cert":        filepath.Join(resolver.ConfigDir(), "server.pem"),
+		"grpc-tls-key":         filepath.Join(resolver.ConfigDir(), "server.key"),
+		"grpc-tls-client-ca":   "",
+		"grpc-tls-min-version": Version12,
+	})
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if tlsConfig.ClientAuth != tls.NoClientCert {
+		t.Errorf("Expected no client auth without client CA, got %v", tlsConfig.ClientAuth)
+	}
+}
+
+func TestServerCfgTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", "Test CA", nil, true)
+	server := newTestCert(t, dir, "server", "localhost", ca, false)
+	client := newTestCert(t, dir, "client", "client", ca, false)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	t.Run("hardened defaults", func(t *testing.T) {
+		tlsConfig, err := ServerCfg{CertFile: server.certFile, KeyFile: server.keyFile}.TLSConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if tlsConfig.MinVersion != tls.VersionTLS12 {
+			t.Errorf("Expected min version to be TLS 1.2, got %x", tlsConfig.MinVersion)
+		}
+		if !reflect.DeepEqual(tlsConfig.CipherSuites, intermediateCipherSuites) {
+			t.Errorf("Expected intermediate cipher suites, got %v", tlsConfig.CipherSuites)
+		}
+		if tlsConfig.ClientAuth != tls.NoClientCert {
+			t.Errorf("Expected no client auth, got %v", tlsConfig.ClientAuth)
+		}
+
+		state, err := handshake(t, tlsConfig, &tls.Config{RootCAs: roots, ServerName: "localhost", MaxVersion: tls.VersionTLS12})
+		if err != nil {
+			t.Fatalf("Expected handshake to succeed, got %v", err)
+		}
+		if state.Version != tls.VersionTLS12 {
+			t.Errorf("Expected TLS 1.2 connection, got %x", state.Version)
+		}
+	})
+
+	t.Run("modern policy rejects TLS 1.2", func(t *testing.T) {
+		tlsConfig, err := ServerCfg{CertFile: server.certFile, KeyFile: server.keyFile, CipherPolicy: CipherPolicyModern}.TLSConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if _, err := handshake(t, tlsConfig, &tls.Config{RootCAs: roots, ServerName: "localhost", MaxVersion: tls.VersionTLS12}); err == nil {
+			t.Error("Expected a TLS 1.2 handshake to fail")
+		}
+	})
+
+	t.Run("client certificates are verified against the client CA", func(t *testing.T) {
+		tlsConfig, err := ServerCfg{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: ca.certFile}.TLSConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Errorf("Expected client auth to default to require and verify, got %v", tlsConfig.ClientAuth)
+		}
+
+		clientCert, err := tls.LoadX509KeyPair(client.certFile, client.keyFile)
+		if err != nil {
+			t.Fatalf("failed to load client certificate: %v", err)
+		}
+
+		state, err := handshake(t, tlsConfig, &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{clientCert}})
+		if err != nil {
+			t.Fatalf("Expected handshake to succeed, got %v", err)
+		}
+		if len(state.PeerCertificates) == 0 || state.PeerCertificates[0].Subject.CommonName != "client" {
+			t.Errorf("Expected client certificate to be verified, got %v", state.PeerCertificates)
+		}
+
+		if _, err := handshake(t, tlsConfig, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err == nil {
+			t.Error("Expected handshake without client certificate to fail")
+		}
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		_, err := ServerCfg{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: server.keyFile}.TLSConfig()
+		if err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, dir, "server", "first", nil, false)
+
+	reloader, err := NewReloader(ServerCfg{CertFile: first.certFile, KeyFile: first.keyFile}, WithReloadCheckInterval(0))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tlsConfig := reloader.TLSConfig()
+
+	servedCommonName := func() string {
+		cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("failed to parse certificate: %v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	if cn := servedCommonName(); cn != "first" {
+		t.Errorf("Expected first certificate to be served, got %s", cn)
+	}
+
+	second := newTestCert(t, t.TempDir(), "server", "second", nil, false)
+	copyFile := func(src, dst string) {
+		content, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", src, err)
+		}
+		if err := os.WriteFile(dst, content, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", dst, err)
+		}
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(dst, later, later)
+	}
+
+	// a certificate without its matching key is not loaded
+	copyFile(second.certFile, first.certFile)
+	if cn := servedCommonName(); cn != "first" {
+		t.Errorf("Expected first certificate to still be served, got %s", cn)
+	}
+	if reloader.LastError() == nil {
+		t.Error("Expected a reload error")
+	}
+
+	copyFile(second.keyFile, first.keyFile)
+	if cn := servedCommonName(); cn != "second" {
+		t.Errorf("Expected second certificate to be served, got %s", cn)
+	}
+	if err := reloader.LastError(); err != nil {
+		t.Errorf("Expected no reload error, got %v", err)
+	}
+}
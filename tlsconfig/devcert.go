@@ -0,0 +1,382 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/teserakt-io/serverlib/path"
+)
+
+// Default names of the development certificate files, in the configuration directory
+var (
+	DevCACertFile     = "dev-ca.pem"
+	DevCAKeyFile      = "dev-ca.key"
+	DevServerCertFile = "dev-server.pem"
+	DevServerKeyFile  = "dev-server.key"
+)
+
+const (
+	// DefaultDevCAValidity is the validity of the generated development CA
+	DefaultDevCAValidity = 10 * 365 * 24 * time.Hour
+	// DefaultDevCertValidity is the validity of the generated development server certificate
+	DefaultDevCertValidity = 365 * 24 * time.Hour
+
+	devCertFileMode os.FileMode = 0644
+	devKeyFileMode  os.FileMode = 0600
+	devDirMode      os.FileMode = 0700
+)
+
+// DefaultDevCertSANs are the subject alternative names of the generated development server certificate
+var DefaultDevCertSANs = []string{"localhost", "127.0.0.1", "::1"}
+
+// DevCertOption defines functions able to alter the development certificates generation
+type DevCertOption func(*devCertOptions)
+
+type devCertOptions struct {
+	sans     []string
+	validity time.Duration
+}
+
+// WithDevCertSANs overrides the DefaultDevCertSANs. IP addresses are added as IP SANs, other values as DNS SANs.
+func WithDevCertSANs(sans ...string) DevCertOption {
+	return func(o *devCertOptions) {
+		o.sans = sans
+	}
+}
+
+// WithDevCertValidity overrides the DefaultDevCertValidity
+func WithDevCertValidity(validity time.Duration) DevCertOption {
+	return func(o *devCertOptions) {
+		o.validity = validity
+	}
+}
+
+// GeneratedFile holds the result of a development certificate file generation
+type GeneratedFile struct {
+	Path string
+	// Generated is false when the file already existed and has been kept
+	Generated bool
+}
+
+// DevCertReport lists the development certificate files
+type DevCertReport struct {
+	CACert     GeneratedFile
+	CAKey      GeneratedFile
+	ServerCert GeneratedFile
+	ServerKey  GeneratedFile
+}
+
+// String returns a human readable report, suitable for a command output
+func (r *DevCertReport) String() string {
+	var b strings.Builder
+	for _, file := range []GeneratedFile{r.CACert, r.CAKey, r.ServerCert, r.ServerKey} {
+		status := "generated"
+		if !file.Generated {
+			status = "exists, skipped"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", file.Path, status)
+	}
+
+	return b.String()
+}
+
+// GenerateDevCerts generates a development CA and a server certificate signed by it in the configuration
+// directory, which is created when missing. Existing files are never overwritten: an existing CA is reused
+// to sign a missing server certificate, and an existing server certificate is kept as is. A server certificate
+// without its CA is an error, as it would not chain to a newly generated CA.
+// Keys are written with 0600 permissions, as expected by PostgreSQL for its ssl_key_file.
+//
+// The server certificate and key can be used by local servers and databases, with clients trusting
+// the CA certificate, or using config.DBSecureConnectionSelfSigned for databases.
+func GenerateDevCerts(resolver path.ConfigDirResolver, opts ...DevCertOption) (*DevCertReport, error) {
+	o := &devCertOptions{
+		sans:     DefaultDevCertSANs,
+		validity: DefaultDevCertValidity,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if len(o.sans) == 0 {
+		return nil, errors.New("at least one subject alternative name is required")
+	}
+
+	if err := os.MkdirAll(resolver.ConfigDir(), devDirMode); err != nil {
+		return nil, err
+	}
+
+	report := &DevCertReport{
+		CACert:     GeneratedFile{Path: resolver.ConfigRelativePath(DevCACertFile)},
+		CAKey:      GeneratedFile{Path: resolver.ConfigRelativePath(DevCAKeyFile)},
+		ServerCert: GeneratedFile{Path: resolver.ConfigRelativePath(DevServerCertFile)},
+		ServerKey:  GeneratedFile{Path: resolver.ConfigRelativePath(DevServerKeyFile)},
+	}
+
+	serverCertExists, err := exists(report.ServerCert.Path, report.ServerKey.Path)
+	if err != nil {
+		return nil, err
+	}
+	caExists, err := exists(report.CACert.Path, report.CAKey.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverCertExists && caExists {
+		return report, nil
+	}
+	if serverCertExists {
+		// a new CA would not have signed the existing server certificate
+		return nil, fmt.Errorf("the server certificate %s exists without its CA, remove it to generate a new CA and server pair",
+			report.ServerCert.Path)
+	}
+
+	var caCert *x509.Certificate
+	var caKey crypto.Signer
+	if caExists {
+		if caCert, caKey, err = loadKeyPair(report.CACert.Path, report.CAKey.Path); err != nil {
+			return nil, fmt.Errorf("failed to load existing development CA: %v", err)
+		}
+	} else {
+		template := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Development CA", Organization: []string{"Teserakt development"}},
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLenZero:        true,
+		}
+		if caCert, caKey, err = generateCert(report.CACert, report.CAKey, template, DefaultDevCAValidity, nil, nil); err != nil {
+			return nil, err
+		}
+		report.CACert.Generated = true
+		report.CAKey.Generated = true
+	}
+
+	if !serverCertExists {
+		template := &x509.Certificate{
+			Subject:     pkix.Name{CommonName: o.sans[0], Organization: []string{"Teserakt development"}},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		for _, san := range o.sans {
+			if ip := net.ParseIP(san); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, san)
+			}
+		}
+
+		if _, _, err := generateCert(report.ServerCert, report.ServerKey, template, o.validity, caCert, caKey); err != nil {
+			return nil, err
+		}
+		report.ServerCert.Generated = true
+		report.ServerKey.Generated = true
+	}
+
+	return report, nil
+}
+
+// DevCertCommand is a subcommand hook generating the development certificates, to be called
+// with the arguments following the subcommand name, such as:
+//
+//	binary gen-dev-certs -san localhost -san db.local -validity 720h
+//
+// The report is written to out.
+func DevCertCommand(args []string, resolver path.ConfigDirResolver, out io.Writer) error {
+	flags := flag.NewFlagSet("gen-dev-certs", flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	var sans stringList
+	flags.Var(&sans, "san", "subject alternative name of the server certificate, can be repeated (default localhost, 127.0.0.1, ::1)")
+	validity := flags.Duration("validity", DefaultDevCertValidity, "validity of the server certificate")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := []DevCertOption{WithDevCertValidity(*validity)}
+	if len(sans) > 0 {
+		opts = append(opts, WithDevCertSANs(sans...))
+	}
+
+	report, err := GenerateDevCerts(resolver, opts...)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(out, report.String())
+
+	return err
+}
+
+// stringList is a repeatable flag.Value
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// exists returns true when both files exist, and an error when only one does
+func exists(certFile, keyFile string) (bool, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+
+	switch {
+	case certErr == nil && keyErr == nil:
+		return true, nil
+	case os.IsNotExist(certErr) && os.IsNotExist(keyErr):
+		return false, nil
+	case certErr != nil && !os.IsNotExist(certErr):
+		return false, certErr
+	case keyErr != nil && !os.IsNotExist(keyErr):
+		return false, keyErr
+	default:
+		return false, fmt.Errorf("only one of %s and %s exists, remove it to generate a new pair", certFile, keyFile)
+	}
+}
+
+// generateCert generates a key and a certificate from template, signed by parent or self-signed when nil,
+// and writes them to their files.
+func generateCert(certFile, keyFile GeneratedFile, template *x509.Certificate, validity time.Duration, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(validity)
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the key is written first, so a failure never leaves a certificate without its key
+	if err := writePEM(keyFile.Path, "PRIVATE KEY", keyDER, devKeyFileMode); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(certFile.Path, "CERTIFICATE", der, devCertFileMode); err != nil {
+		os.Remove(keyFile.Path)
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// writePEM creates filename with the given mode, failing when it exists
+func writePEM(filename, blockType string, der []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(filename), devDirMode); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+
+	// explicit chmod, so the mode does not depend on the umask
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+
+	return f.Close()
+}
+
+// loadKeyPair loads a PEM certificate and its PKCS8, PKCS1 or EC private key
+func loadKeyPair(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	certs, err := readCertificates(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no certificate found in %s", certFile)
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no private key found in %s", keyFile)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key %s: %v", keyFile, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type in %s", keyFile)
+	}
+
+	return certs[0], signer, nil
+}
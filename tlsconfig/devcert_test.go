@@ -0,0 +1,126 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/teserakt-io/serverlib/config/configtest"
+)
+
+func TestGenerateDevCerts(t *testing.T) {
+	resolver := configtest.NewTempResolver(t, nil)
+
+	report, err := GenerateDevCerts(resolver, WithDevCertSANs("localhost", "db.local", "127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !report.CACert.Generated || !report.CAKey.Generated || !report.ServerCert.Generated || !report.ServerKey.Generated {
+		t.Errorf("Expected every file to be generated, got %#v", report)
+	}
+
+	for file, expectedMode := range map[string]os.FileMode{
+		report.CACert.Path:     0644,
+		report.CAKey.Path:      0600,
+		report.ServerCert.Path: 0644,
+		report.ServerKey.Path:  0600,
+	} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Expected %s to exist, got %v", file, err)
+		}
+		if info.Mode().Perm() != expectedMode {
+			t.Errorf("Expected %s mode to be %v, got %v", file, expectedMode, info.Mode().Perm())
+		}
+	}
+
+	caCerts, err := readCertificates(report.CACert.Path)
+	if err != nil {
+		t.Fatalf("failed to read CA: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCerts[0])
+
+	serverCert, err := tls.LoadX509KeyPair(report.ServerCert.Path, report.ServerKey.Path)
+	if err != nil {
+		t.Fatalf("failed to load server certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(serverCert.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse server certificate: %v", err)
+	}
+	for _, host := range []string{"localhost", "db.local", "127.0.0.1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Expected server certificate to be valid for %s, got %v", host, err)
+		}
+	}
+
+	t.Run("existing files are kept", func(t *testing.T) {
+		os.Remove(report.ServerCert.Path)
+		os.Remove(report.ServerKey.Path)
+		caContent, _ := os.ReadFile(report.CACert.Path)
+
+		var out bytes.Buffer
+		if err := DevCertCommand([]string{"-san", "other.local"}, resolver, &out); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if strings.Count(out.String(), "exists, skipped") != 2 || strings.Count(out.String(), "generated") != 2 {
+			t.Errorf("Expected the CA to be skipped and the server certificate generated, got:\n%s", out.String())
+		}
+
+		newCAContent, _ := os.ReadFile(report.CACert.Path)
+		if !bytes.Equal(caContent, newCAContent) {
+			t.Error("Expected the CA to be kept")
+		}
+
+		certs, err := readCertificates(report.ServerCert.Path)
+		if err != nil {
+			t.Fatalf("failed to read server certificate: %v", err)
+		}
+		if _, err := certs[0].Verify(x509.VerifyOptions{DNSName: "other.local", Roots: roots}); err != nil {
+			t.Errorf("Expected new server certificate to be signed by the existing CA, got %v", err)
+		}
+	})
+
+	t.Run("a server certificate without CA fails", func(t *testing.T) {
+		os.Remove(report.CACert.Path)
+		os.Remove(report.CAKey.Path)
+		serverContent, _ := os.ReadFile(report.ServerCert.Path)
+
+		if _, err := GenerateDevCerts(resolver); err == nil {
+			t.Error("Expected an error")
+		}
+
+		if _, err := os.Stat(report.CACert.Path); !os.IsNotExist(err) {
+			t.Errorf("Expected no CA to be generated, got %v", err)
+		}
+		newServerContent, _ := os.ReadFile(report.ServerCert.Path)
+		if !bytes.Equal(serverContent, newServerContent) {
+			t.Error("Expected the server certificate to be kept")
+		}
+	})
+
+	t.Run("a certificate without key fails", func(t *testing.T) {
+		os.Remove(report.ServerKey.Path)
+		if _, err := GenerateDevCerts(resolver); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
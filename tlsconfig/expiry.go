@@ -0,0 +1,331 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/teserakt-io/serverlib/config"
+	"github.com/teserakt-io/serverlib/health"
+)
+
+const (
+	// DefaultExpiryMonitorName is the name reported by the ExpiryMonitor health checker
+	DefaultExpiryMonitorName = "certificates"
+	// DefaultExpiryCheckInterval is the default delay between two certificate checks
+	DefaultExpiryCheckInterval = time.Hour
+)
+
+// DefaultExpiryThresholds are the default remaining durations under which a warning is logged
+var DefaultExpiryThresholds = []time.Duration{30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour}
+
+// CertificateExpiry holds the expiry of a certificate found in a monitored file
+type CertificateExpiry struct {
+	File string
+	// Index is the position of the certificate in the file, for bundles and chains
+	Index    int
+	Subject  string
+	NotAfter time.Time
+	// DaysLeft is the number of whole days before expiry, negative once expired
+	DaysLeft int
+	// Threshold is the smallest threshold crossed, or zero when none is
+	Threshold time.Duration
+}
+
+// Expired returns true when the certificate is expired
+func (e CertificateExpiry) Expired() bool {
+	return e.DaysLeft < 0
+}
+
+// ExpiryMonitor defines a service periodically checking the expiry of certificate files.
+// Warnings are logged when a certificate crosses a threshold, and an error once it has expired.
+// The monitor is reported unhealthy while a certificate is expired or a file cannot be read.
+type ExpiryMonitor interface {
+	health.Checker
+	// Check reads the files once, logs the crossed thresholds and updates the status accordingly
+	Check() error
+	// Expiries returns the certificates found by the last check, sorted by expiry
+	Expiries() []CertificateExpiry
+	// Run checks the files every interval until ctx is done
+	Run(ctx context.Context)
+}
+
+// ExpiryMonitorOption defines functions able to alter an ExpiryMonitor
+type ExpiryMonitorOption func(*expiryMonitor)
+
+// WithExpiryMonitorName overrides the DefaultExpiryMonitorName
+func WithExpiryMonitorName(name string) ExpiryMonitorOption {
+	return func(m *expiryMonitor) {
+		m.name = name
+	}
+}
+
+// WithExpiryCheckInterval overrides the DefaultExpiryCheckInterval.
+// Non positive intervals are ignored.
+func WithExpiryCheckInterval(interval time.Duration) ExpiryMonitorOption {
+	return func(m *expiryMonitor) {
+		if interval > 0 {
+			m.interval = interval
+		}
+	}
+}
+
+// WithExpiryThresholds overrides the DefaultExpiryThresholds
+func WithExpiryThresholds(thresholds ...time.Duration) ExpiryMonitorOption {
+	return func(m *expiryMonitor) {
+		m.thresholds = thresholds
+	}
+}
+
+// WithExpiryLogger overrides the default slog logger
+func WithExpiryLogger(logger *slog.Logger) ExpiryMonitorOption {
+	return func(m *expiryMonitor) {
+		m.logger = logger
+	}
+}
+
+type expiryMonitor struct {
+	files      []string
+	name       string
+	interval   time.Duration
+	thresholds []time.Duration
+	logger     *slog.Logger
+	now        func() time.Time
+
+	lock     sync.RWMutex
+	status   health.Status
+	expiries []CertificateExpiry
+	// crossed holds the last logged threshold of each certificate, or expiredCrossing, to log each crossing once
+	crossed map[string]time.Duration
+}
+
+// expiredCrossing is the crossed value of expired certificates
+const expiredCrossing time.Duration = -1
+
+var _ ExpiryMonitor = (*expiryMonitor)(nil)
+
+// NewExpiryMonitor creates a new ExpiryMonitor of the certificates found in files.
+// The monitor is reported unhealthy until the first check.
+func NewExpiryMonitor(files []string, opts ...ExpiryMonitorOption) ExpiryMonitor {
+	m := &expiryMonitor{
+		files:      files,
+		name:       DefaultExpiryMonitorName,
+		interval:   DefaultExpiryCheckInterval,
+		thresholds: DefaultExpiryThresholds,
+		logger:     slog.Default(),
+		now:        time.Now,
+		crossed:    make(map[string]time.Duration),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// CertificateFiles returns the loaded values of the ViperRelativePath fields holding PEM certificates,
+// such as the ones returned by ServerCfg.ViperCfgFields, so key files and unset fields are skipped.
+func CertificateFiles(fields []config.ViperCfgField) []string {
+	var files []string
+	for _, field := range fields {
+		if field.CfgType != config.ViperRelativePath {
+			continue
+		}
+
+		file, ok := field.Target.(*string)
+		if !ok || *file == "" {
+			continue
+		}
+		if certs, err := readCertificates(*file); err == nil && len(certs) > 0 {
+			files = append(files, *file)
+		}
+	}
+
+	return files
+}
+
+func (m *expiryMonitor) Name() string {
+	return m.name
+}
+
+func (m *expiryMonitor) Status() health.Status {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.status
+}
+
+func (m *expiryMonitor) Expiries() []CertificateExpiry {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return append([]CertificateExpiry(nil), m.expiries...)
+}
+
+func (m *expiryMonitor) Check() error {
+	now := m.now()
+
+	var expiries []CertificateExpiry
+	var err error
+	for _, file := range m.files {
+		certs, readErr := readCertificates(file)
+		if readErr == nil && len(certs) == 0 {
+			readErr = fmt.Errorf("no certificate found in %s", file)
+		}
+		if readErr != nil {
+			m.logger.Error("failed to read certificate file", "file", file, "error", readErr)
+			if err == nil {
+				err = readErr
+			}
+			continue
+		}
+
+		for i, cert := range certs {
+			expiry := m.expiry(file, i, cert, now)
+			expiries = append(expiries, expiry)
+
+			if expiry.Expired() && err == nil {
+				err = fmt.Errorf("certificate %s in %s expired on %s", expiry.Subject, file, expiry.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+
+	sort.SliceStable(expiries, func(i, j int) bool {
+		return expiries[i].NotAfter.Before(expiries[j].NotAfter)
+	})
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, expiry := range expiries {
+		m.log(expiry)
+	}
+
+	m.expiries = expiries
+	m.status.LastCheck = now
+	if err != nil {
+		m.status.Healthy = false
+		m.status.ConsecutiveFailures++
+		m.status.LastError = err
+		return err
+	}
+
+	m.status.Healthy = true
+	m.status.ConsecutiveFailures = 0
+	m.status.LastError = nil
+	m.status.LastSuccess = now
+
+	return nil
+}
+
+func (m *expiryMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *expiryMonitor) expiry(file string, index int, cert *x509.Certificate, now time.Time) CertificateExpiry {
+	left := cert.NotAfter.Sub(now)
+
+	expiry := CertificateExpiry{
+		File:     file,
+		Index:    index,
+		Subject:  cert.Subject.String(),
+		NotAfter: cert.NotAfter,
+		// floored, so a certificate expired for less than a day is not reported with 0 days left
+		DaysLeft: int(math.Floor(left.Hours() / 24)),
+	}
+
+	for _, threshold := range m.thresholds {
+		if left < threshold && (expiry.Threshold == 0 || threshold < expiry.Threshold) {
+			expiry.Threshold = threshold
+		}
+	}
+
+	return expiry
+}
+
+// log reports the threshold crossings and the expiry, expected to be called with the lock held
+func (m *expiryMonitor) log(expiry CertificateExpiry) {
+	crossing := expiry.Threshold
+	if expiry.Expired() {
+		crossing = expiredCrossing
+	}
+
+	key := fmt.Sprintf("%s#%d", expiry.File, expiry.Index)
+	previous, logged := m.crossed[key]
+	m.crossed[key] = crossing
+	if logged && crossing == previous {
+		return
+	}
+
+	attrs := []interface{}{
+		"file", expiry.File,
+		"subject", expiry.Subject,
+		"not_after", expiry.NotAfter,
+		"days_left", expiry.DaysLeft,
+	}
+
+	switch {
+	case expiry.Expired():
+		m.logger.Error("certificate expired", attrs...)
+	case expiry.Threshold != 0:
+		m.logger.Warn("certificate expires soon", attrs...)
+	}
+}
+
+// readCertificates returns every certificate of a PEM file
+func readCertificates(file string) ([]*x509.Certificate, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %s: %v", file, err)
+		}
+		certs = append(certs, cert)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiryMonitor(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", "Test CA", nil, true, func(cert *x509.Certificate) {
+		cert.NotAfter = time.Now().Add(365 * 24 * time.Hour)
+	})
+	server := newTestCert(t, dir, "server", "localhost", ca, false, func(cert *x509.Certificate) {
+		cert.NotAfter = time.Now().Add(10*24*time.Hour + time.Hour)
+	})
+
+	t.Run("certificate files are found from the fields", func(t *testing.T) {
+		cfg := ServerCfg{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: ca.certFile}
+		fields := cfg.ViperCfgFields("")
+
+		files := CertificateFiles(fields)
+		expectedFiles := []string{server.certFile, ca.certFile}
+		if !reflect.DeepEqual(files, expectedFiles) {
+			t.Errorf("Expected files %v, got %v", expectedFiles, files)
+		}
+	})
+
+	var logs bytes.Buffer
+	monitor := NewExpiryMonitor(
+		[]string{ca.certFile, server.certFile},
+		WithExpiryLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	).(*expiryMonitor)
+
+	if monitor.Status().Healthy {
+		t.Error("Expected monitor to be unhealthy before the first check")
+	}
+
+	t.Run("thresholds crossings are logged once", func(t *testing.T) {
+		if err := monitor.Check(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expiries := monitor.Expiries()
+		if len(expiries) != 2 {
+			t.Fatalf("Expected 2 expiries, got %d", len(expiries))
+		}
+		if expiries[0].File != server.certFile || expiries[0].DaysLeft != 10 || expiries[0].Threshold != 30*24*time.Hour {
+			t.Errorf("Unexpected server certificate expiry %#v", expiries[0])
+		}
+		if expiries[1].File != ca.certFile || expiries[1].Threshold != 0 {
+			t.Errorf("Unexpected CA certificate expiry %#v", expiries[1])
+		}
+		if count := strings.Count(logs.String(), "certificate expires soon"); count != 1 {
+			t.Errorf("Expected 1 warning, got %d: %s", count, logs.String())
+		}
+
+		monitor.Check()
+		if count := strings.Count(logs.String(), "certificate expires soon"); count != 1 {
+			t.Errorf("Expected no new warning, got %d: %s", count, logs.String())
+		}
+
+		monitor.now = func() time.Time { return time.Now().Add(5 * 24 * time.Hour) }
+		monitor.Check()
+		if count := strings.Count(logs.String(), "certificate expires soon"); count != 2 {
+			t.Errorf("Expected a warning on the 7 days threshold, got %d: %s", count, logs.String())
+		}
+
+		if !monitor.Status().Healthy {
+			t.Errorf("Expected monitor to be healthy, got %v", monitor.Status().LastError)
+		}
+	})
+
+	t.Run("expired certificates are unhealthy", func(t *testing.T) {
+		monitor.now = func() time.Time { return time.Now().Add(11 * 24 * time.Hour) }
+		if err := monitor.Check(); err == nil {
+			t.Error("Expected an error")
+		}
+
+		status := monitor.Status()
+		if status.Healthy || status.LastError == nil {
+			t.Errorf("Expected monitor to be unhealthy, got %#v", status)
+		}
+		if expiry := monitor.Expiries()[0]; !expiry.Expired() || expiry.DaysLeft != -1 {
+			t.Errorf("Expected server certificate to be expired by 1 day, got %#v", expiry)
+		}
+		if count := strings.Count(logs.String(), "certificate expired"); count != 1 {
+			t.Errorf("Expected an expiry error log, got %d: %s", count, logs.String())
+		}
+
+		monitor.Check()
+		if count := strings.Count(logs.String(), "certificate expired"); count != 1 {
+			t.Errorf("Expected the expiry to be logged once, got %d: %s", count, logs.String())
+		}
+	})
+
+	t.Run("non positive check intervals are ignored", func(t *testing.T) {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			monitor := NewExpiryMonitor(nil, WithExpiryCheckInterval(interval)).(*expiryMonitor)
+			if monitor.interval != DefaultExpiryCheckInterval {
+				t.Errorf("Expected interval %v to be ignored, got %v", interval, monitor.interval)
+			}
+		}
+	})
+
+	t.Run("unreadable files are unhealthy", func(t *testing.T) {
+		monitor := NewExpiryMonitor([]string{filepath.Join(dir, "missing.pem")}, WithExpiryLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+		if err := monitor.Check(); err == nil {
+			t.Error("Expected an error")
+		}
+		if monitor.Status().Healthy {
+			t.Error("Expected monitor to be unhealthy")
+		}
+	})
+}
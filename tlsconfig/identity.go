@@ -0,0 +1,276 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// List of supported identity sources, telling which certificate attribute names the client
+const (
+	// IdentitySourceCommonName uses the subject common name
+	IdentitySourceCommonName = "common-name"
+	// IdentitySourceURISAN uses the first URI subject alternative name, such as a SPIFFE ID
+	IdentitySourceURISAN = "uri-san"
+	// IdentitySourceDNSSAN uses the first DNS subject alternative name
+	IdentitySourceDNSSAN = "dns-san"
+	// IdentitySourceEmailSAN uses the first email subject alternative name
+	IdentitySourceEmailSAN = "email-san"
+	// IdentitySourceSPKI uses the SPKI pin of the certificate public key
+	IdentitySourceSPKI = "spki"
+)
+
+// spkiPinPrefix is the optional prefix of configured SPKI pins
+const spkiPinPrefix = "sha256/"
+
+var (
+	// ErrIdentityNotAllowed is returned when a client certificate matches none of the allow-lists
+	ErrIdentityNotAllowed = errors.New("client identity not allowed")
+	// ErrNoIdentity is returned when the client certificate has no value for the identity source
+	ErrNoIdentity = errors.New("no client identity found in certificate")
+)
+
+// Identity holds the authenticated identity of a client, from its certificate
+type Identity struct {
+	// Name is the certificate attribute selected by the IdentitySource
+	Name string
+	// Subject is the certificate subject distinguished name, such as CN=client,O=Teserakt
+	Subject    string
+	CommonName string
+	DNSNames   []string
+	Emails     []string
+	URIs       []string
+	// SPKIPin is the base64 encoded SHA-256 of the certificate public key
+	SPKIPin     string
+	Certificate *x509.Certificate
+}
+
+// SPKIPin returns the base64 encoded SHA-256 of the certificate subject public key info,
+// as produced by openssl x509 -pubkey | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ClientIdentityCfg holds the mapping of client certificates to identities, and their allow-lists.
+// A client certificate is accepted when it matches any entry of the allow-lists,
+// or when every allow-list is empty.
+type ClientIdentityCfg struct {
+	// Source is one of the IdentitySource, defaulting to IdentitySourceCommonName
+	Source string
+	// AllowedSubjects lists the allowed subject common names or distinguished names
+	AllowedSubjects []string
+	// AllowedSANs lists the allowed DNS, email or URI subject alternative names
+	AllowedSANs []string
+	// AllowedSPKIPins lists the allowed SPKI pins, optionally prefixed by sha256/
+	AllowedSPKIPins []string
+}
+
+// Validate checks the configuration is usable
+func (c ClientIdentityCfg) Validate() error {
+	switch c.Source {
+	case "", IdentitySourceCommonName, IdentitySourceURISAN, IdentitySourceDNSSAN, IdentitySourceEmailSAN, IdentitySourceSPKI:
+	default:
+		return fmt.Errorf("unsupported TLS identity source %q", c.Source)
+	}
+
+	for _, pin := range c.AllowedSPKIPins {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, spkiPinPrefix))
+		if err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("invalid SPKI pin %q, expected a base64 encoded SHA-256", pin)
+		}
+	}
+
+	return nil
+}
+
+// Identity maps cert to an Identity, returning ErrNoIdentity when the certificate has no value for the Source
+func (c ClientIdentityCfg) Identity(cert *x509.Certificate) (Identity, error) {
+	identity := Identity{
+		Subject:     cert.Subject.String(),
+		CommonName:  cert.Subject.CommonName,
+		DNSNames:    cert.DNSNames,
+		Emails:      cert.EmailAddresses,
+		SPKIPin:     SPKIPin(cert),
+		Certificate: cert,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+
+	switch c.Source {
+	case IdentitySourceURISAN:
+		identity.Name = first(identity.URIs)
+	case IdentitySourceDNSSAN:
+		identity.Name = first(identity.DNSNames)
+	case IdentitySourceEmailSAN:
+		identity.Name = first(identity.Emails)
+	case IdentitySourceSPKI:
+		identity.Name = identity.SPKIPin
+	default:
+		identity.Name = identity.CommonName
+	}
+
+	if identity.Name == "" {
+		return Identity{}, fmt.Errorf("%w: subject %s", ErrNoIdentity, identity.Subject)
+	}
+
+	return identity, nil
+}
+
+// Allowed returns true when the identity matches the allow-lists
+func (c ClientIdentityCfg) Allowed(identity Identity) bool {
+	return c.allowed(identity, true)
+}
+
+// allowed returns true when the identity matches the allow-lists. The subject and SAN allow-lists
+// are ignored when the certificate has not been verified, as anyone can forge them.
+func (c ClientIdentityCfg) allowed(identity Identity, verified bool) bool {
+	if !c.restricted() {
+		return true
+	}
+
+	if verified {
+		for _, subject := range c.AllowedSubjects {
+			if subject == identity.CommonName || subject == identity.Subject {
+				return true
+			}
+		}
+		for _, san := range c.AllowedSANs {
+			if contains(identity.DNSNames, san) || contains(identity.Emails, san) || contains(identity.URIs, san) {
+				return true
+			}
+		}
+	}
+	for _, pin := range c.AllowedSPKIPins {
+		if strings.TrimPrefix(pin, spkiPinPrefix) == identity.SPKIPin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConnectionIdentity returns the Identity of the client of a TLS connection, such as the State of
+// the gRPC credentials.TLSInfo, or the TLS field of an http.Request.
+// The verified leaf certificate is used. Unverified certificates, from the request and require-any
+// client auth modes, are only identified with the IdentitySourceSPKI.
+func (c ClientIdentityCfg) ConnectionIdentity(state tls.ConnectionState) (Identity, error) {
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		return c.Identity(state.VerifiedChains[0][0])
+	}
+	if len(state.PeerCertificates) == 0 {
+		return Identity{}, fmt.Errorf("%w: no client certificate", ErrNoIdentity)
+	}
+	if c.Source != IdentitySourceSPKI {
+		return Identity{}, fmt.Errorf("%w: unverified client certificate", ErrNoIdentity)
+	}
+
+	return c.Identity(state.PeerCertificates[0])
+}
+
+// verifyPeerCertificate is a tls.Config VerifyPeerCertificate callback rejecting client certificates
+// without identity or not matching the allow-lists. Connections without client certificate are left to
+// the client auth mode, unless allow-lists are set.
+func (c ClientIdentityCfg) verifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	var cert *x509.Certificate
+	verified := false
+	switch {
+	case len(verifiedChains) > 0 && len(verifiedChains[0]) > 0:
+		cert = verifiedChains[0][0]
+		verified = true
+	case len(rawCerts) > 0:
+		var err error
+		if cert, err = x509.ParseCertificate(rawCerts[0]); err != nil {
+			return err
+		}
+	case c.restricted():
+		return fmt.Errorf("%w: no client certificate", ErrIdentityNotAllowed)
+	default:
+		return nil
+	}
+
+	identity, err := c.Identity(cert)
+	if err != nil {
+		return err
+	}
+	if !c.allowed(identity, verified) {
+		return fmt.Errorf("%w: %s", ErrIdentityNotAllowed, identity.Subject)
+	}
+
+	return nil
+}
+
+// restricted returns true when an allow-list is set
+func (c ClientIdentityCfg) restricted() bool {
+	return len(c.AllowedSubjects) > 0 || len(c.AllowedSANs) > 0 || len(c.AllowedSPKIPins) > 0
+}
+
+type identityContextKey struct{}
+
+// ContextWithIdentity returns a copy of ctx holding the identity
+func ContextWithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored in ctx, and false when there is none
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(Identity)
+	return identity, ok
+}
+
+// IdentityMiddleware stores the identity of the client certificate in the request context,
+// retrieved in handlers with IdentityFromContext. Requests without identity are rejected with 401 Unauthorized.
+func (c ClientIdentityCfg) IdentityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := c.ConnectionIdentity(*r.TLS)
+		verified := len(r.TLS.VerifiedChains) > 0
+		if err != nil || !c.allowed(identity, verified) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ContextWithIdentity(r.Context(), identity)))
+	})
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientIdentity(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", "Test CA", nil, true)
+	client := newTestCert(t, dir, "client", "client", ca, false, func(cert *x509.Certificate) {
+		cert.EmailAddresses = []string{"client@example.com"}
+		cert.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/client"}}
+	})
+
+	t.Run("identity sources", func(t *testing.T) {
+		testData := map[string]string{
+			"":                     "client",
+			IdentitySourceDNSSAN:   "client",
+			IdentitySourceEmailSAN: "client@example.com",
+			IdentitySourceURISAN:   "spiffe://example.com/client",
+			IdentitySourceSPKI:     SPKIPin(client.cert),
+		}
+
+		for source, expectedName := range testData {
+			identity, err := ClientIdentityCfg{Source: source}.Identity(client.cert)
+			if err != nil {
+				t.Fatalf("Expected no error for source %q, got %v", source, err)
+			}
+			if identity.Name != expectedName {
+				t.Errorf("Expected identity name for source %q to be %s, got %s", source, expectedName, identity.Name)
+			}
+		}
+
+		_, err := ClientIdentityCfg{Source: IdentitySourceURISAN}.Identity(ca.cert)
+		if !errors.Is(err, ErrNoIdentity) {
+			t.Errorf("Expected ErrNoIdentity, got %v", err)
+		}
+	})
+
+	t.Run("allow-lists", func(t *testing.T) {
+		identity, err := ClientIdentityCfg{}.Identity(client.cert)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		testData := []struct {
+			name     string
+			cfg      ClientIdentityCfg
+			expected bool
+		}{
+			{name: "no allow-list", cfg: ClientIdentityCfg{}, expected: true},
+			{name: "common name", cfg: ClientIdentityCfg{AllowedSubjects: []string{"other", "client"}}, expected: true},
+			{name: "distinguished name", cfg: ClientIdentityCfg{AllowedSubjects: []string{"CN=client"}}, expected: true},
+			{name: "other subject", cfg: ClientIdentityCfg{AllowedSubjects: []string{"other"}}, expected: false},
+			{name: "uri san", cfg: ClientIdentityCfg{AllowedSANs: []string{"spiffe://example.com/client"}}, expected: true},
+			{name: "email san", cfg: ClientIdentityCfg{AllowedSANs: []string{"client@example.com"}}, expected: true},
+			{name: "other san", cfg: ClientIdentityCfg{AllowedSANs: []string{"other.example.com"}}, expected: false},
+			{name: "spki pin", cfg: ClientIdentityCfg{AllowedSPKIPins: []string{"sha256/" + SPKIPin(client.cert)}}, expected: true},
+			{name: "other spki pin", cfg: ClientIdentityCfg{AllowedSPKIPins: []string{SPKIPin(ca.cert)}}, expected: false},
+		}
+
+		for _, data := range testData {
+			if allowed := data.cfg.Allowed(identity); allowed != data.expected {
+				t.Errorf("%s: expected allowed to be %v, got %v", data.name, data.expected, allowed)
+			}
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		if err := (ClientIdentityCfg{Source: "serial"}).Validate(); err == nil {
+			t.Error("Expected an error on unknown source")
+		}
+		if err := (ClientIdentityCfg{AllowedSPKIPins: []string{"not a pin"}}).Validate(); err == nil {
+			t.Error("Expected an error on invalid pin")
+		}
+		cfg := ServerCfg{CertFile: "cert.pem", KeyFile: "key.pem", ClientIdentity: ClientIdentityCfg{AllowedSubjects: []string{"client"}}}
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an error on allow-lists without client auth")
+		}
+	})
+
+	t.Run("handshake rejects clients not allowed", func(t *testing.T) {
+		server := newTestCert(t, dir, "server", "localhost", ca, false)
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+
+		clientCert, err := tls.LoadX509KeyPair(client.certFile, client.keyFile)
+		if err != nil {
+			t.Fatalf("failed to load client certificate: %v", err)
+		}
+		clientConfig := &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{clientCert}}
+
+		cfg := ServerCfg{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: ca.certFile}
+
+		cfg.ClientIdentity.AllowedSubjects = []string{"client"}
+		tlsConfig, err := cfg.TLSConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := handshake(t, tlsConfig, clientConfig); err != nil {
+			t.Errorf("Expected allowed client handshake to succeed, got %v", err)
+		}
+
+		cfg.ClientIdentity.AllowedSubjects = []string{"other"}
+		tlsConfig, err = cfg.TLSConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := handshake(t, tlsConfig, clientConfig); !errors.Is(err, ErrIdentityNotAllowed) {
+			t.Errorf("Expected ErrIdentityNotAllowed, got %v", err)
+		}
+	})
+
+	t.Run("self-signed certificates cannot spoof an allowed subject", func(t *testing.T) {
+		server := newTestCert(t, dir, "server", "localhost", ca, false)
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+
+		spoofer := newTestCert(t, dir, "spoofer", "client", nil, false, func(cert *x509.Certificate) {
+			cert.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/client"}}
+		})
+		spooferCert, err := tls.LoadX509KeyPair(spoofer.certFile, spoofer.keyFile)
+		if err != nil {
+			t.Fatalf("failed to load spoofer certificate: %v", err)
+		}
+		spooferConfig := &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{spooferCert}}
+		anonymousConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+
+		allowList := ClientIdentityCfg{AllowedSubjects: []string{"client"}, AllowedSANs: []string{"spiffe://example.com/client"}}
+		for _, clientAuth := range []string{ClientAuthRequest, ClientAuthRequireAny} {
+			cfg := ServerCfg{CertFile: server.certFile, KeyFile: server.keyFile, ClientAuth: clientAuth, ClientIdentity: allowList}
+			if _, err := cfg.TLSConfig(); err == nil {
+				t.Errorf("Expected subject allow-lists to be rejected with client auth %s", clientAuth)
+			}
+		}
+
+		cfg := ServerCfg{
+			CertFile:       server.certFile,
+			KeyFile:        server.keyFile,
+			ClientCAFile:   ca.certFile,
+			ClientAuth:     ClientAuthVerifyIfGiven,
+			ClientIdentity: allowList,
+		}
+		tlsConfig, err := cfg.TLSConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := handshake(t, tlsConfig, spooferConfig); err == nil {
+			t.Error("Expected the self-signed certificate handshake to fail")
+		}
+		if _, err := handshake(t, tlsConfig, anonymousConfig); !errors.Is(err, ErrIdentityNotAllowed) {
+			t.Errorf("Expected ErrIdentityNotAllowed without certificate, got %v", err)
+		}
+
+		cfg = ServerCfg{
+			CertFile:   server.certFile,
+			KeyFile:    server.keyFile,
+			ClientAuth: ClientAuthRequireAny,
+			ClientIdentity: ClientIdentityCfg{
+				Source:          IdentitySourceSPKI,
+				AllowedSPKIPins: []string{SPKIPin(client.cert)},
+			},
+		}
+		tlsConfig, err = cfg.TLSConfig()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := handshake(t, tlsConfig, spooferConfig); !errors.Is(err, ErrIdentityNotAllowed) {
+			t.Errorf("Expected ErrIdentityNotAllowed for a pinned mismatch, got %v", err)
+		}
+	})
+
+	t.Run("middleware stores the identity in the context", func(t *testing.T) {
+		cfg := ClientIdentityCfg{AllowedSubjects: []string{"client"}}
+
+		var identity Identity
+		var found bool
+		handler := cfg.IdentityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, found = IdentityFromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d without TLS, got %d", http.StatusUnauthorized, rec.Code)
+		}
+
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client.cert}}
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d with an unverified certificate, got %d", http.StatusUnauthorized, rec.Code)
+		}
+
+		req.TLS.VerifiedChains = [][]*x509.Certificate{{client.cert, ca.cert}}
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if !found || identity.Name != "client" {
+			t.Errorf("Expected client identity in context, got %#v", identity)
+		}
+	})
+}
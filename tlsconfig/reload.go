@@ -0,0 +1,207 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadCheckInterval is the minimum delay between two checks of the files modification
+const DefaultReloadCheckInterval = 10 * time.Second
+
+// Reloader provides a server TLS configuration whose certificate, key and client CA
+// are reloaded when their files change. Files are checked on new connections, at most once per interval.
+// When a reload fails, such as when the certificate has been replaced but not yet its key,
+// the previous material is kept and the reload is retried on the next check.
+type Reloader struct {
+	cfg           ServerCfg
+	base          *tls.Config
+	checkInterval time.Duration
+
+	lock      sync.Mutex
+	current   *tls.Config
+	stamps    []fileStamp
+	lastCheck time.Time
+	lastError error
+}
+
+// ReloaderOption defines functions able to alter a Reloader
+type ReloaderOption func(*Reloader)
+
+// WithReloadCheckInterval overrides the DefaultReloadCheckInterval
+func WithReloadCheckInterval(interval time.Duration) ReloaderOption {
+	return func(r *Reloader) {
+		r.checkInterval = interval
+	}
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader validates cfg and loads its files, returning an error when they are not usable.
+func NewReloader(cfg ServerCfg, opts ...ReloaderOption) (*Reloader, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	base, err := cfg.baseTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{
+		cfg:           cfg,
+		base:          base,
+		checkInterval: DefaultReloadCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// TLSConfig returns the server *tls.Config, always serving the latest loaded material
+func (r *Reloader) TLSConfig() *tls.Config {
+	tlsConfig := r.base.Clone()
+	tlsConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &r.config().Certificates[0], nil
+	}
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return r.config(), nil
+	}
+
+	return tlsConfig
+}
+
+// Files returns the certificate, key and client CA files in use, the latter when configured
+func (r *Reloader) Files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+
+	return files
+}
+
+// Reload loads the files, regardless of their modification
+func (r *Reloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.reload(r.fileStamps())
+}
+
+// LastError returns the error of the last failed reload, or nil when the last reload succeeded
+func (r *Reloader) LastError() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.lastError
+}
+
+// config returns the current configuration, after reloading the files when they changed
+func (r *Reloader) config() *tls.Config {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if time.Since(r.lastCheck) >= r.checkInterval {
+		r.lastCheck = time.Now()
+		if stamps := r.fileStamps(); !sameStamps(stamps, r.stamps) {
+			// errors are kept in lastError, the previous configuration remains in use
+			r.reload(stamps)
+		}
+	}
+
+	return r.current
+}
+
+func (r *Reloader) reload(stamps []fileStamp) error {
+	tlsConfig, err := r.load()
+	if err != nil {
+		r.lastError = err
+		return err
+	}
+
+	r.current = tlsConfig
+	r.stamps = stamps
+	r.lastCheck = time.Now()
+	r.lastError = nil
+
+	return nil
+}
+
+func (r *Reloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+
+	tlsConfig := r.base.Clone()
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS client CA: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in TLS client CA file %s", r.cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// fileStamps returns the current stamps of the files, a zero stamp standing for a missing file
+func (r *Reloader) fileStamps() []fileStamp {
+	files := r.Files()
+	stamps := make([]fileStamp, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+
+	return stamps
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/teserakt-io/serverlib/lifecycle"
+)
+
+// DefaultComponentName is the name of the Provider lifecycle.Component
+const DefaultComponentName = "tracing"
+
+// TraceFileMode is the mode of the created file exporter output
+const TraceFileMode os.FileMode = 0640
+
+// Option defines functions able to alter a Provider
+type Option func(*options)
+
+type options struct {
+	serviceVersion string
+	attributes     []attribute.KeyValue
+	stdout         io.Writer
+}
+
+// WithServiceVersion sets the service.version resource attribute of the spans
+func WithServiceVersion(version string) Option {
+	return func(o *options) {
+		o.serviceVersion = version
+	}
+}
+
+// WithResourceAttributes adds resource attributes to the spans, such as the deployment environment
+func WithResourceAttributes(attributes ...attribute.KeyValue) Option {
+	return func(o *options) {
+		o.attributes = append(o.attributes, attributes...)
+	}
+}
+
+// Provider holds the tracer provider built from the configuration
+type Provider struct {
+	trace.TracerProvider
+
+	// sdk is nil when tracing is disabled
+	sdk        *sdktrace.TracerProvider
+	propagator propagation.TextMapPropagator
+	file       *os.File
+}
+
+// New validates cfg and creates a new Provider, installed with the trace context and baggage propagators
+// as the otel globals. When tracing is disabled, the provider does not record any span.
+// The OTLP exporters connect lazily, so New does not fail when the collector is unreachable.
+func New(ctx context.Context, cfg TracingCfg, opts ...Option) (*Provider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	o := &options{stdout: os.Stdout}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	p := &Provider{
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+
+	if !cfg.Enabled {
+		p.TracerProvider = noop.NewTracerProvider()
+	} else {
+		exporter, err := p.exporter(ctx, cfg, o)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := newResource(cfg, o)
+		if err != nil {
+			exporter.Shutdown(ctx)
+			p.closeFile()
+			return nil, err
+		}
+
+		p.sdk = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sampler(cfg)),
+		)
+		p.TracerProvider = p.sdk
+	}
+
+	otel.SetTracerProvider(p.TracerProvider)
+	otel.SetTextMapPropagator(p.propagator)
+
+	return p, nil
+}
+
+// Propagator returns the propagator of the trace context between services
+func (p *Provider) Propagator() propagation.TextMapPropagator {
+	return p.propagator
+}
+
+// ForceFlush exports the ended spans which are not exported yet
+func (p *Provider) ForceFlush(ctx context.Context) error {
+	if p.sdk == nil {
+		return nil
+	}
+
+	return p.sdk.ForceFlush(ctx)
+}
+
+// Shutdown exports the remaining spans and stops the exporter, until ctx is done
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.sdk == nil {
+		return nil
+	}
+
+	err := p.sdk.Shutdown(ctx)
+	if closeErr := p.closeFile(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Component returns the lifecycle component shutting the provider down, to be registered
+// before the components creating spans so it is stopped after them.
+func (p *Provider) Component() lifecycle.Component {
+	return lifecycle.Component{
+		Name: DefaultComponentName,
+		Stop: p.Shutdown,
+	}
+}
+
+func (p *Provider) exporter(ctx context.Context, cfg TracingCfg, o *options) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(o.stdout))
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, TraceFileMode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tracing file: %v", err)
+		}
+		p.file = f
+
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	case ExporterOTLPGRPC:
+		var grpcOpts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			if isURL(cfg.Endpoint) {
+				grpcOpts = append(grpcOpts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+			} else {
+				grpcOpts = append(grpcOpts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+			}
+		}
+		if cfg.Insecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.New(ctx, grpcOpts...)
+	case ExporterOTLPHTTP:
+		var httpOpts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			if isURL(cfg.Endpoint) {
+				httpOpts = append(httpOpts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+			} else {
+				httpOpts = append(httpOpts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+			}
+		}
+		if cfg.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, httpOpts...)
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q", cfg.Exporter)
+	}
+}
+
+func (p *Provider) closeFile() error {
+	if p.file == nil {
+		return nil
+	}
+
+	err := p.file.Close()
+	p.file = nil
+
+	return err
+}
+
+func newResource(cfg TracingCfg, o *options) (*resource.Resource, error) {
+	attributes := []attribute.KeyValue{semconv.ServiceName(cfg.ServiceName)}
+	if o.serviceVersion != "" {
+		attributes = append(attributes, semconv.ServiceVersion(o.serviceVersion))
+	}
+	attributes = append(attributes, o.attributes...)
+
+	return resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attributes...))
+}
+
+func sampler(cfg TracingCfg) sdktrace.Sampler {
+	switch cfg.Sampler {
+	case SamplerAlways:
+		return sdktrace.AlwaysSample()
+	case SamplerNever:
+		return sdktrace.NeverSample()
+	case SamplerRatio:
+		return sdktrace.TraceIDRatioBased(cfg.SamplerRatio)
+	default:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplerRatio))
+	}
+}
+
+// isURL returns true when endpoint holds a scheme, such as http://localhost:4318
+func isURL(endpoint string) bool {
+	return strings.Contains(endpoint, "://")
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing initialises the OpenTelemetry tracing of the server applications from their configuration,
+// so every service samples and exports its spans the same way.
+//
+//	var tracingCfg tracing.TracingCfg
+//	loader.Load(tracingCfg.ViperCfgFields())
+//
+//	provider, err := tracing.New(ctx, tracingCfg, tracing.WithServiceVersion(version))
+//	manager.Register(provider.Component())
+//
+//	ctx, span := provider.Tracer("c2").Start(ctx, "handle-command")
+//	defer span.End()
+//
+// The provider and the W3C trace context and baggage propagators are installed as the otel globals.
+// The stdout and file exporters allow inspecting the spans without a collector.
+package tracing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/teserakt-io/serverlib/config"
+)
+
+// List of supported span exporters
+const (
+	// ExporterStdout writes the spans as JSON lines to the standard output
+	ExporterStdout = "stdout"
+	// ExporterFile writes the spans as JSON lines to File
+	ExporterFile = "file"
+	// ExporterOTLPGRPC sends the spans to Endpoint with the OTLP/gRPC protocol
+	ExporterOTLPGRPC = "otlp-grpc"
+	// ExporterOTLPHTTP sends the spans to Endpoint with the OTLP/HTTP protocol
+	ExporterOTLPHTTP = "otlp-http"
+)
+
+// List of supported samplers
+const (
+	// SamplerAlways samples every span
+	SamplerAlways = "always"
+	// SamplerNever samples no span
+	SamplerNever = "never"
+	// SamplerRatio samples SamplerRatio of the traces
+	SamplerRatio = "ratio"
+	// SamplerParentRatio follows the sampling decision of the parent span, and samples SamplerRatio of the root spans
+	SamplerParentRatio = "parent-ratio"
+)
+
+// TracingCfg holds the tracing configuration
+type TracingCfg struct {
+	// Enabled records and exports spans when true. Otherwise the spans are not recorded,
+	// but the trace context is still propagated.
+	Enabled bool
+	// ServiceName is the service.name resource attribute of the spans
+	ServiceName string
+	// Sampler is one of the supported samplers
+	Sampler string
+	// SamplerRatio is the ratio of the sampled traces, between 0 and 1, for the ratio samplers
+	SamplerRatio float64
+	// Exporter is one of the supported span exporters
+	Exporter string
+	// File is the path of the file exporter output, relative to the configuration directory
+	File string
+	// Endpoint is the host:port of the OTLP collector, or the URL of its traces endpoint used as is,
+	// such as http://collector:4318/v1/traces for the otlp-http exporter. When empty, the exporters
+	// use the standard OTEL_EXPORTER_OTLP_ENDPOINT base URL, or their default.
+	Endpoint string
+	// Insecure disables TLS for the OTLP exporters
+	Insecure bool
+}
+
+// ViperCfgFields returns the list of configuration fields needed to load a TracingCfg
+func (c *TracingCfg) ViperCfgFields() []config.ViperCfgField {
+	return []config.ViperCfgField{
+		{Target: &c.Enabled, KeyName: "tracing-enabled", CfgType: config.ViperBool, DefaultValue: false},
+		{Target: &c.ServiceName, KeyName: "tracing-service-name", CfgType: config.ViperString, DefaultValue: "", EnvMapping: "OTEL_SERVICE_NAME"},
+		{Target: &c.Sampler, KeyName: "tracing-sampler", CfgType: config.ViperString, DefaultValue: SamplerParentRatio},
+		{Target: &c.SamplerRatio, KeyName: "tracing-sampler-ratio", CfgType: config.ViperFloat64, DefaultValue: 1.0},
+		{Target: &c.Exporter, KeyName: "tracing-exporter", CfgType: config.ViperString, DefaultValue: ExporterStdout},
+		{Target: &c.File, KeyName: "tracing-file", CfgType: config.ViperRelativePath, DefaultValue: ""},
+		{Target: &c.Endpoint, KeyName: "tracing-endpoint", CfgType: config.ViperString, DefaultValue: "", EnvMapping: "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"},
+		{Target: &c.Insecure, KeyName: "tracing-insecure", CfgType: config.ViperBool, DefaultValue: false},
+	}
+}
+
+// Validate checks the configuration is usable. Only the enabled configurations are checked.
+func (c TracingCfg) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.ServiceName == "" {
+		return errors.New("tracing service name is required")
+	}
+
+	switch c.Sampler {
+	case SamplerAlways, SamplerNever:
+	case SamplerRatio, SamplerParentRatio:
+		if c.SamplerRatio < 0 || c.SamplerRatio > 1 {
+			return fmt.Errorf("tracing sampler ratio must be between 0 and 1, got %v", c.SamplerRatio)
+		}
+	default:
+		return fmt.Errorf("unsupported tracing sampler %q, must be one of %s, %s, %s, %s",
+			c.Sampler, SamplerAlways, SamplerNever, SamplerRatio, SamplerParentRatio)
+	}
+
+	switch c.Exporter {
+	case ExporterStdout, ExporterOTLPGRPC, ExporterOTLPHTTP:
+	case ExporterFile:
+		if c.File == "" {
+			return errors.New("tracing file is required for the file exporter")
+		}
+	default:
+		return fmt.Errorf("unsupported tracing exporter %q, must be one of %s, %s, %s, %s",
+			c.Exporter, ExporterStdout, ExporterFile, ExporterOTLPGRPC, ExporterOTLPHTTP)
+	}
+
+	return nil
+}
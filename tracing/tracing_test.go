@@ -0,0 +1,231 @@
+// Copyright 2020 Teserakt AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/teserakt-io/serverlib/config/configtest"
+	"github.com/teserakt-io/serverlib/lifecycle"
+)
+
+func TestTracingCfg(t *testing.T) {
+	t.Run("fields are loaded with defaults", func(t *testing.T) {
+		var cfg TracingCfg
+		fields := cfg.ViperCfgFields()
+		configtest.UnsetEnv(t, "OTEL_SERVICE_NAME", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		configtest.MustLoad(t, configtest.NewLoader(t, "yaml", "tracing-enabled: true\ntracing-service-name: c2\ntracing-sampler-ratio: 0.1\n"), fields)
+
+		configtest.AssertFields(t, fields, map[string]interface{}{
+			"tracing-enabled":       true,
+			"tracing-service-name":  "c2",
+			"tracing-sampler":       SamplerParentRatio,
+			"tracing-sampler-ratio": 0.1,
+			"tracing-exporter":      ExporterStdout,
+			"tracing-file":          "",
+			"tracing-endpoint":      "",
+		})
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("invalid configurations", func(t *testing.T) {
+		valid := TracingCfg{Enabled: true, ServiceName: "c2", Sampler: SamplerParentRatio, SamplerRatio: 1, Exporter: ExporterStdout}
+		for name, alter := range map[string]func(c *TracingCfg){
+			"service name": func(c *TracingCfg) { c.ServiceName = "" },
+			"sampler":      func(c *TracingCfg) { c.Sampler = "sometimes" },
+			"ratio":        func(c *TracingCfg) { c.SamplerRatio = 1.5 },
+			"exporter":     func(c *TracingCfg) { c.Exporter = "jaeger" },
+			"file":         func(c *TracingCfg) { c.Exporter = ExporterFile },
+		} {
+			cfg := valid
+			alter(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Errorf("Expected an error on invalid %s", name)
+			}
+
+			cfg.Enabled = false
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Expected disabled configuration with invalid %s to be valid, got %v", name, err)
+			}
+		}
+	})
+}
+
+func TestProvider(t *testing.T) {
+	t.Run("disabled tracing only propagates", func(t *testing.T) {
+		p, err := New(context.Background(), TracingCfg{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		_, span := p.Tracer("test").Start(context.Background(), "operation")
+		if span.IsRecording() {
+			t.Error("Expected spans not to be recorded")
+		}
+		span.End()
+
+		if fields := otel.GetTextMapPropagator().Fields(); !contains(fields, "traceparent") || !contains(fields, "baggage") {
+			t.Errorf("Expected trace context and baggage propagators, got %v", fields)
+		}
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("file exporter shut down by the lifecycle", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "traces.json")
+		p, err := New(context.Background(), TracingCfg{
+			Enabled:     true,
+			ServiceName: "c2",
+			Sampler:     SamplerAlways,
+			Exporter:    ExporterFile,
+			File:        file,
+		}, WithServiceVersion("1.2.3"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		manager := lifecycle.NewManager(lifecycle.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+		manager.Register(p.Component())
+		manager.Start(context.Background())
+
+		// spans of the global tracer provider are exported too
+		ctx, parent := otel.Tracer("test").Start(context.Background(), "parent-operation")
+		_, child := p.Tracer("test").Start(ctx, "child-operation")
+		child.End()
+		parent.End()
+
+		if err := manager.Stop(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		content, _ := os.ReadFile(file)
+		for _, expected := range []string{`"Name":"parent-operation"`, `"Name":"child-operation"`, `"Value":"c2"`, `"Value":"1.2.3"`} {
+			if !strings.Contains(string(content), expected) {
+				t.Errorf("Expected exported spans to contain %s, got %s", expected, content)
+			}
+		}
+	})
+
+	t.Run("stdout exporter with never sampler", func(t *testing.T) {
+		var b bytes.Buffer
+		cfg := TracingCfg{Enabled: true, ServiceName: "c2", Sampler: SamplerNever, Exporter: ExporterStdout}
+		p, err := New(context.Background(), cfg, func(o *options) { o.stdout = &b })
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		_, span := p.Tracer("test").Start(context.Background(), "operation")
+		span.End()
+		p.Shutdown(context.Background())
+
+		if b.Len() != 0 {
+			t.Errorf("Expected no exported span, got %s", b.String())
+		}
+	})
+
+	t.Run("OTLP HTTP exporter", func(t *testing.T) {
+		var lock sync.Mutex
+		var paths []string
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			paths = append(paths, r.URL.Path)
+			lock.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer collector.Close()
+
+		export := func(t *testing.T, endpoint string) {
+			t.Helper()
+
+			p, err := New(context.Background(), TracingCfg{
+				Enabled:      true,
+				ServiceName:  "c2",
+				Sampler:      SamplerRatio,
+				SamplerRatio: 1,
+				Exporter:     ExporterOTLPHTTP,
+				Endpoint:     endpoint,
+				Insecure:     true,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			_, span := p.Tracer("test").Start(context.Background(), "operation")
+			span.End()
+			if err := p.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		export(t, collector.URL)
+		// traces endpoint URLs are used as is
+		export(t, collector.URL+"/prefix/v1/traces")
+		// the standard base URL gets the traces path appended
+		configtest.SetEnv(t, map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": collector.URL + "/base"})
+		export(t, "")
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, expected := range []string{"/v1/traces", "/prefix/v1/traces", "/base/v1/traces"} {
+			if !contains(paths, expected) {
+				t.Errorf("Expected spans to be sent to %s, got %v", expected, paths)
+			}
+		}
+	})
+
+	t.Run("propagation between services", func(t *testing.T) {
+		p, err := New(context.Background(), TracingCfg{Enabled: true, ServiceName: "c2", Sampler: SamplerAlways, Exporter: ExporterStdout},
+			func(o *options) { o.stdout = io.Discard })
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer p.Shutdown(context.Background())
+
+		ctx, span := p.Tracer("test").Start(context.Background(), "client")
+		defer span.End()
+
+		carrier := propagation.HeaderCarrier{}
+		p.Propagator().Inject(ctx, carrier)
+		if !strings.Contains(carrier.Get("traceparent"), span.SpanContext().TraceID().String()) {
+			t.Errorf("Expected traceparent header to hold the trace ID, got %q", carrier.Get("traceparent"))
+		}
+	})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}